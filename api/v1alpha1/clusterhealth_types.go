@@ -0,0 +1,130 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterHealthSpec defines the desired state of ClusterHealth
+type ClusterHealthSpec struct {
+	// NamespaceSelector selects the namespaces whose Health is aggregated.
+	// Every namespace with a Health resource is aggregated when it is empty.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Nodes enables the summary of node health when set
+	// +optional
+	Nodes *NodeSummarySpec `json:"nodes,omitempty"`
+}
+
+// NodeSummarySpec configures the summary of node health
+type NodeSummarySpec struct {
+	// GroupByLabel is the node label whose values group nodes, e.g.
+	// topology.kubernetes.io/zone or a node pool label. All nodes are in
+	// one group named "all" when it is empty, nodes without the label
+	// are in the group "none".
+	// +optional
+	GroupByLabel string `json:"groupByLabel,omitempty"`
+}
+
+// NodeGroupSummary is the rolled up state of a group of nodes
+type NodeGroupSummary struct {
+	// Status is "ready" when every node of the group is ready and has no
+	// memory, disk or PID pressure
+	Status string `json:"status"`
+	// Ready is the number of ready nodes
+	Ready int32 `json:"ready"`
+	// NotReady is the number of nodes that are not ready
+	NotReady int32 `json:"notReady"`
+	// Cordoned is the number of unschedulable nodes
+	// +optional
+	Cordoned int32 `json:"cordoned,omitempty"`
+	// MemoryPressure is the number of nodes with memory pressure
+	// +optional
+	MemoryPressure int32 `json:"memoryPressure,omitempty"`
+	// DiskPressure is the number of nodes with disk pressure
+	// +optional
+	DiskPressure int32 `json:"diskPressure,omitempty"`
+	// PIDPressure is the number of nodes with PID pressure
+	// +optional
+	PIDPressure int32 `json:"pidPressure,omitempty"`
+	// Taints maps taints as key:effect to the number of nodes having them
+	// +optional
+	Taints map[string]int32 `json:"taints,omitempty"`
+	// NotReadyNodes lists the first nodes which are not ready or under pressure
+	// +optional
+	NotReadyNodes []string `json:"notReadyNodes,omitempty"`
+}
+
+// NamespaceSummary is the rolled up state of the Health of a namespace
+type NamespaceSummary struct {
+	// Status is the rollup of the namespace by the criticality of its
+	// components, one of "ready", "degraded" or "down"
+	Status string `json:"status"`
+	// Ready is the number of ready components
+	Ready int32 `json:"ready"`
+	// NotReady is the number of components that are not ready
+	NotReady int32 `json:"notReady"`
+	// NotReadyComponents lists the first not ready components as app/component
+	// +optional
+	NotReadyComponents []string `json:"notReadyComponents,omitempty"`
+}
+
+// ClusterHealthStatus defines the observed state of ClusterHealth
+type ClusterHealthStatus struct {
+	// Status is "ready" when every aggregated namespace and node group is ready
+	// +optional
+	Status string `json:"status,omitempty"`
+	// Namespaces maps namespace names to the summary of their Health
+	// +optional
+	Namespaces map[string]NamespaceSummary `json:"namespaces,omitempty"`
+	// Nodes maps node groups to their summary, only set when the node
+	// summary is enabled
+	// +optional
+	Nodes map[string]NodeGroupSummary `json:"nodes,omitempty"`
+	// Conditions of the cluster, the Ready condition reflects the global state
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterHealth is the Schema for the clusterhealths API
+type ClusterHealth struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterHealthSpec   `json:"spec,omitempty"`
+	Status ClusterHealthStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterHealthList contains a list of ClusterHealth
+type ClusterHealthList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterHealth `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterHealth{}, &ClusterHealthList{})
+}
@@ -0,0 +1,64 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition describes one aspect of the observed state of a resource
+type Condition struct {
+	// Type of the condition, e.g. Ready
+	Type string `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status metav1.ConditionStatus `json:"status"`
+	// Reason is a machine readable explanation of the status
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable explanation of the status
+	// +optional
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the status changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// SetCondition adds or updates a condition of the given type in conditions.
+// LastTransitionTime is only moved when the status changes.
+func SetCondition(conditions *[]Condition, condition Condition) {
+	for i := range *conditions {
+		existing := &(*conditions)[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return
+	}
+	*conditions = append(*conditions, condition)
+}
+
+// FindCondition returns the condition of the given type or nil
+func FindCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
@@ -17,19 +17,670 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // HealthSpec defines the desired state of Health
 type HealthSpec struct {
+	// IgnoreUnavailableNodes excludes cordoned and NotReady nodes when
+	// checking that DaemonSets run a ready pod on every node, so that a
+	// node outage does not mark every DaemonSet notready
+	// +optional
+	IgnoreUnavailableNodes bool `json:"ignoreUnavailableNodes,omitempty"`
+	// ScaledDown decides whether Deployments and StatefulSets scaled to
+	// zero replicas are healthy, Healthy by default
+	// +optional
+	ScaledDown InactivePolicy `json:"scaledDown,omitempty"`
+	// Paused decides whether paused Deployments are healthy, Healthy by
+	// default
+	// +optional
+	Paused InactivePolicy `json:"paused,omitempty"`
+	// Dependencies between applications and components. A component whose
+	// dependencies are not healthy is reported as impacted in its
+	// effective status.
+	// +optional
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	// Criticality maps applications ("app") and components
+	// ("app/component") to their criticality, components are normal by
+	// default
+	// +optional
+	Criticality map[string]Criticality `json:"criticality,omitempty"`
+	// Rollup decides how unhealthy components of each criticality affect
+	// the rollup of the namespace and of each application
+	// +optional
+	Rollup RollupPolicy `json:"rollup,omitempty"`
+	// Prometheus queries reported as components
+	// +optional
+	Prometheus *PrometheusSpec `json:"prometheus,omitempty"`
+	// StaleAfter is how long a component is trusted after it was last
+	// evaluated, 15m by default. Older components are reported unknown.
+	// +optional
+	StaleAfter *metav1.Duration `json:"staleAfter,omitempty"`
+	// Hysteresis delays reporting components becoming unhealthy or
+	// recovering, so that short lived changes during pod churn are not
+	// reported
+	// +optional
+	Hysteresis *Hysteresis `json:"hysteresis,omitempty"`
+	// Objectives maps applications ("app") and components
+	// ("app/component") to their availability target over 30 days in
+	// percent, e.g. "99.9"
+	// +optional
+	Objectives map[string]string `json:"objectives,omitempty"`
+	// Nodes publishes the groups of nodes as components of the "nodes"
+	// application when set, so that they roll up with the applications.
+	// Only available when the operator watches all namespaces.
+	// +optional
+	Nodes *NodeSummarySpec `json:"nodes,omitempty"`
+}
+
+// NodesApplication is the application node groups are published as
+const NodesApplication = "nodes"
+
+// Hysteresis configures the delays before changes between healthy and
+// unhealthy statuses of components are reported and the detection of
+// flapping components
+type Hysteresis struct {
+	// DownAfter is how long a healthy component must be evaluated as
+	// unhealthy before it is reported, immediately by default
+	// +optional
+	DownAfter *metav1.Duration `json:"downAfter,omitempty"`
+	// RecoverAfter is how long an unhealthy component must be evaluated
+	// as healthy before it is reported, immediately by default
+	// +optional
+	RecoverAfter *metav1.Duration `json:"recoverAfter,omitempty"`
+	// FlappingTransitions is the number of changes between healthy and
+	// unhealthy within FlappingWindow from which a component is marked
+	// flapping, flapping is not detected when zero
+	// +optional
+	FlappingTransitions int32 `json:"flappingTransitions,omitempty"`
+	// FlappingWindow is the period transitions are counted in, 10m by
+	// default
+	// +optional
+	FlappingWindow *metav1.Duration `json:"flappingWindow,omitempty"`
+}
+
+// DefaultStaleAfter is the time after which a component which was not
+// evaluated is unknown when StaleAfter is not set
+const DefaultStaleAfter = 15 * time.Minute
+
+// StaleAfterDuration returns StaleAfter or its default
+func (s HealthSpec) StaleAfterDuration() time.Duration {
+	if s.StaleAfter != nil && s.StaleAfter.Duration > 0 {
+		return s.StaleAfter.Duration
+	}
+	return DefaultStaleAfter
+}
+
+// ComponentStaleAfter returns how long status is trusted after it was
+// evaluated, StaleAfter or twice the interval of components evaluated on a
+// schedule when that is longer
+func (s HealthSpec) ComponentStaleAfter(status ComponentStatus) time.Duration {
+	staleAfter := s.StaleAfterDuration()
+	if status.Interval != nil && 2*status.Interval.Duration > staleAfter {
+		return 2 * status.Interval.Duration
+	}
+	return staleAfter
+}
+
+// Stale reports whether status was last evaluated longer than
+// ComponentStaleAfter before now. Components without an evaluation time
+// are never stale.
+func (s HealthSpec) Stale(status ComponentStatus, now time.Time) bool {
+	return status.LastEvaluated != nil && now.Sub(status.LastEvaluated.Time) > s.ComponentStaleAfter(status)
+}
+
+// PrometheusSpec configures the Prometheus server and the queries whose
+// results are reported as components
+type PrometheusSpec struct {
+	// URL of the Prometheus server, the --prometheus-url flag of the
+	// operator when empty. Other URLs must be listed in the
+	// --prometheus-urls flag of the operator.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Interval between evaluations of the queries, 1m by default
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Queries to evaluate
+	Queries []PrometheusQuery `json:"queries"`
+}
+
+// PrometheusQuery maps the value of a PromQL expression to the status of a
+// component. The component is down when the value reaches Down, degraded
+// when it reaches Degraded and ready otherwise. The highest value is used
+// when the query returns several samples and a query returning no samples
+// is ready, like an alert which does not fire.
+type PrometheusQuery struct {
+	// Component the result is reported as, "app/component"
+	// +kubebuilder:validation:Pattern=`^[^/]+/[^/]+$`
+	Component string `json:"component"`
+	// Query is the PromQL expression
+	Query string `json:"query"`
+	// Degraded threshold, a decimal number
+	// +optional
+	Degraded string `json:"degraded,omitempty"`
+	// Down threshold, a decimal number
+	// +optional
+	Down string `json:"down,omitempty"`
+	// Below reverses the comparisons, for queries like availability where
+	// lower values are worse. The lowest value is used then.
+	// +optional
+	Below bool `json:"below,omitempty"`
+}
+
+// Criticality of a component, one of critical, normal or optional
+// +kubebuilder:validation:Enum=critical;normal;optional
+type Criticality string
+
+const (
+	// CriticalityCritical components are essential
+	CriticalityCritical Criticality = "critical"
+	// CriticalityNormal components are needed for full service
+	CriticalityNormal Criticality = "normal"
+	// CriticalityOptional components can fail without affecting service
+	CriticalityOptional Criticality = "optional"
+)
+
+// RollupPolicy lists the criticalities of which a single unhealthy
+// component makes a rollup down or degraded
+type RollupPolicy struct {
+	// Down criticalities, [critical] by default
+	// +optional
+	Down []Criticality `json:"down,omitempty"`
+	// Degraded criticalities, [normal] by default
+	// +optional
+	Degraded []Criticality `json:"degraded,omitempty"`
+}
+
+// Dependency declares what an application or a component depends on.
+// References are either "app" for every component of an application or
+// "app/component".
+type Dependency struct {
+	// Component is the dependent application or component
+	Component string `json:"component"`
+	// DependsOn lists the applications and components required by Component
+	DependsOn []string `json:"dependsOn"`
+}
+
+// InactivePolicy decides whether a component intentionally not running or
+// not rolling out counts as healthy in rollups
+// +kubebuilder:validation:Enum=Healthy;Unhealthy
+type InactivePolicy string
+
+const (
+	// InactiveHealthy counts the component as healthy
+	InactiveHealthy InactivePolicy = "Healthy"
+	// InactiveUnhealthy counts the component as not healthy
+	InactiveUnhealthy InactivePolicy = "Unhealthy"
+)
+
+// Healthy reports whether a component counts as healthy in rollups
+func (s HealthSpec) Healthy(status ComponentStatus) bool {
+	switch status.Status {
+	case StatusScaledDown:
+		return s.ScaledDown != InactiveUnhealthy
+	case StatusPaused:
+		return s.Paused != InactiveUnhealthy && status.endpointsReady()
+	}
+	return status.IsReady()
+}
+
+const (
+	// StatusReady is reported for a component whose workload is fully rolled out and available
+	StatusReady = "ready"
+	// StatusNotReady is reported for a component whose workload is not available
+	StatusNotReady = "notready"
+	// StatusPartiallyRolled is reported for a StatefulSet whose pods are
+	// available but only some of them are updated, as intended by a
+	// partition or the OnDelete update strategy
+	StatusPartiallyRolled = "partially-rolled"
+	// StatusScaledDown is reported for a Deployment or StatefulSet scaled
+	// to zero replicas
+	StatusScaledDown = "scaled-down"
+	// StatusPaused is reported for a paused Deployment
+	StatusPaused = "paused"
+	// StatusImpacted is the effective status of a healthy component with a
+	// dependency which is not healthy
+	StatusImpacted = "impacted"
+	// StatusDegraded is the rollup of components of which some that are
+	// not critical are not healthy, and the status of a Prometheus query
+	// reaching its degraded threshold
+	StatusDegraded = "degraded"
+	// StatusDown is the rollup of components of which a critical one is
+	// not healthy, and the status of a Prometheus query reaching its down
+	// threshold
+	StatusDown = "down"
+	// StatusUnknown is reported for a component whose state could not be
+	// determined, like a Prometheus query when Prometheus is unreachable
+	// or a component which was not evaluated for longer than StaleAfter,
+	// and is the rollup of components of which some that are unknown
+	// would make it down or degraded
+	StatusUnknown = "unknown"
+)
+
+// PodDiagnostic summarizes one cause of the pods of a component not being ready
+type PodDiagnostic struct {
+	// Reason is one of CrashLoopBackOff, ImagePullBackOff, Unschedulable,
+	// OOMKilled or ReadinessProbeFailed
+	Reason string `json:"reason"`
+	// Pods is the number of pods affected
+	Pods int32 `json:"pods"`
+	// Message describes the cause for one of the affected pods
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// VolumeDiagnostic describes a problem with a PersistentVolumeClaim of a component
+type VolumeDiagnostic struct {
+	// Claim is the name of the PersistentVolumeClaim
+	Claim string `json:"claim"`
+	// Reason is one of Pending, Lost, Resizing, FileSystemResizePending
+	// or CapacityMismatch
+	Reason string `json:"reason"`
+	// Message describes the problem
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DaemonSetCounts are the pod counters of a DaemonSet
+type DaemonSetCounts struct {
+	// Desired is the number of nodes which should run a pod
+	Desired int32 `json:"desired"`
+	// Ready is the number of nodes running a ready pod
+	Ready int32 `json:"ready"`
+	// Unavailable is the number of nodes which should run a pod but have
+	// no available one
+	Unavailable int32 `json:"unavailable"`
+	// Misscheduled is the number of nodes running a pod which should not
+	Misscheduled int32 `json:"misscheduled"`
+	// MissingNodes lists nodes without a ready pod, at most ten
+	// +optional
+	MissingNodes []string `json:"missingNodes,omitempty"`
+	// IgnoredNodes is the number of cordoned or NotReady nodes without a
+	// ready pod which were ignored
+	// +optional
+	IgnoredNodes int32 `json:"ignoredNodes,omitempty"`
 }
 
-// HealthStatus defines the observed state of Health
+// EndpointStatus is the number of ready endpoints of a Service of a component
+type EndpointStatus struct {
+	// Ready is the number of ready endpoints
+	Ready int32 `json:"ready"`
+	// Minimum is the number of ready endpoints required
+	Minimum int32 `json:"minimum"`
+}
+
+// ComponentStatus defines the observed state of an application component
+type ComponentStatus struct {
+	// Status of the component, one of "ready", "notready",
+	// "partially-rolled", "scaled-down" or "paused", and "degraded",
+	// "down" or "unknown" for Prometheus queries. Stale components are
+	// "unknown".
+	Status string `json:"status"`
+	// Generation of the Kubernetes object the status was calculated for
+	Generation int64 `json:"generation"`
+	// LastEvaluated is when the status was last calculated. The operator
+	// evaluates every component periodically, so an old time means the
+	// status can no longer be trusted.
+	// +optional
+	LastEvaluated *metav1.Time `json:"lastEvaluated,omitempty"`
+	// Interval between evaluations of components evaluated on a schedule,
+	// HealthChecks and Prometheus queries. They become stale after twice
+	// the interval when that is longer than StaleAfter.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Source is the object the status is evaluated from, e.g.
+	// "Deployment/nova-api", or "Health/health/prometheus" for queries of
+	// the spec. The component is removed with its source.
+	// +optional
+	Source string `json:"source,omitempty"`
+	// Reason is a machine readable explanation of the status, e.g.
+	// BackoffLimitExceeded for a failed Job
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable explanation of the status
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Partition of a partially rolled StatefulSet, pods with a lower
+	// ordinal are not updated
+	// +optional
+	Partition *int32 `json:"partition,omitempty"`
+	// Diagnostics lists the most common causes of pods not being ready,
+	// only set when the component is not ready
+	// +optional
+	Diagnostics []PodDiagnostic `json:"diagnostics,omitempty"`
+	// Volumes lists the claims of a StatefulSet which are not bound or
+	// not of the requested size
+	// +optional
+	Volumes []VolumeDiagnostic `json:"volumes,omitempty"`
+	// DaemonSet counters, only set for DaemonSets
+	// +optional
+	DaemonSet *DaemonSetCounts `json:"daemonSet,omitempty"`
+	// NodeGroup summary, only set for the node groups published as
+	// components of the nodes application
+	// +optional
+	NodeGroup *NodeGroupSummary `json:"nodeGroup,omitempty"`
+	// Rollout of the current revision of a Deployment, StatefulSet or
+	// DaemonSet
+	// +optional
+	Rollout *Rollout `json:"rollout,omitempty"`
+	// Endpoints of the Services of the component by Service name, only
+	// set when Services are watched
+	// +optional
+	Endpoints map[string]EndpointStatus `json:"endpoints,omitempty"`
+	// EffectiveStatus takes the dependencies of the component into
+	// account, one of "ready", "notready" or "impacted". Only set for
+	// components with dependencies.
+	// +optional
+	EffectiveStatus string `json:"effectiveStatus,omitempty"`
+	// ImpactedBy lists the unhealthy dependencies, direct or indirect,
+	// which the effective status is impacted by
+	// +optional
+	ImpactedBy []string `json:"impactedBy,omitempty"`
+	// SilencedBy is the name of the active HealthSilence matching the
+	// component, which leaves it out of rollups
+	// +optional
+	SilencedBy string `json:"silencedBy,omitempty"`
+	// Acknowledgement of the current failure of the component, recorded
+	// from an annotation of the Health
+	// +optional
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"`
+	// PendingStatus is the last evaluated status when it is not reported
+	// yet because of the hysteresis of the spec
+	// +optional
+	PendingStatus string `json:"pendingStatus,omitempty"`
+	// PendingSince is when the component was first evaluated as healthy
+	// or unhealthy like PendingStatus
+	// +optional
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
+	// Transitions are the times of the recent changes of the evaluated
+	// status between healthy and unhealthy, only kept when flapping is
+	// detected
+	// +optional
+	Transitions []metav1.Time `json:"transitions,omitempty"`
+	// Flapping is set when the component changed between healthy and
+	// unhealthy more often than the hysteresis of the spec allows
+	// +optional
+	Flapping bool `json:"flapping,omitempty"`
+	// Availability of the component over rolling windows, calculated
+	// from its changes between healthy and unhealthy
+	// +optional
+	Availability *Availability `json:"availability,omitempty"`
+	// Incidents are the last periods the component was unhealthy, oldest
+	// first and at most ten. The last one is open while the component is
+	// unhealthy.
+	// +optional
+	Incidents []Incident `json:"incidents,omitempty"`
+}
+
+// Rollout of a revision of a workload
+type Rollout struct {
+	// Generation of the workload when last evaluated
+	Generation int64 `json:"generation"`
+	// Revision rolled out, the pod template hash of a Deployment and the
+	// controller revision of a StatefulSet or DaemonSet
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Images of the containers of the pod template
+	// +optional
+	Images []string `json:"images,omitempty"`
+	// Started is when the revision or images were first seen, unset when
+	// they were already rolled out then
+	// +optional
+	Started *metav1.Time `json:"started,omitempty"`
+	// Finished is when all pods were updated and available, unset while
+	// the rollout is in progress
+	// +optional
+	Finished *metav1.Time `json:"finished,omitempty"`
+	// Duration of the rollout once it finished
+	// +optional
+	Duration string `json:"duration,omitempty"`
+}
+
+// Incident is a period a component was unhealthy
+type Incident struct {
+	// Start is when the component became unhealthy
+	Start metav1.Time `json:"start"`
+	// End is when the component recovered, unset while it is unhealthy
+	// +optional
+	End *metav1.Time `json:"end,omitempty"`
+	// Duration of the incident once it ended
+	// +optional
+	Duration string `json:"duration,omitempty"`
+	// Status of the component when the incident started
+	Status string `json:"status"`
+	// Reason of the status when the incident started
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message of the status when the incident started
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Generation of the object of the component when the incident started
+	Generation int64 `json:"generation"`
+	// Notified is when an Event was last sent for the incident
+	// +optional
+	Notified *metav1.Time `json:"notified,omitempty"`
+}
+
+// AvailabilityChange is a change of a component between healthy and
+// unhealthy
+type AvailabilityChange struct {
+	// Time of the change
+	Time metav1.Time `json:"time"`
+	// Healthy is the state the component changed to
+	Healthy bool `json:"healthy"`
+}
+
+// Availability is the share of time a component was healthy. Percentages
+// cover the time since tracking started when it is shorter than their
+// window. Unknown states keep the previous state.
+type Availability struct {
+	// Changes between healthy and unhealthy, oldest first and at most 100.
+	// The first one is when tracking started or the oldest change kept.
+	Changes []AvailabilityChange `json:"changes"`
+	// Hour is the availability over the last hour in percent
+	Hour string `json:"hour"`
+	// Day is the availability over the last 24 hours in percent
+	Day string `json:"day"`
+	// Month is the availability over the last 30 days in percent
+	Month string `json:"month"`
+	// Objective is the availability target over 30 days from the spec
+	// +optional
+	Objective string `json:"objective,omitempty"`
+	// ErrorBudgetRemaining is the percentage of the error budget of the
+	// objective left over the last 30 days, negative when exhausted
+	// +optional
+	ErrorBudgetRemaining string `json:"errorBudgetRemaining,omitempty"`
+	// Evaluated is when the percentages were calculated
+	Evaluated metav1.Time `json:"evaluated"`
+}
+
+// IsReady reports whether the component is ready or partially rolled and
+// its Service, if any, has enough ready endpoints
+func (s ComponentStatus) IsReady() bool {
+	return (s.Status == StatusReady || s.Status == StatusPartiallyRolled) && s.endpointsReady()
+}
+
+// endpointsReady reports whether the Services of the component, if any,
+// have enough ready endpoints
+func (s ComponentStatus) endpointsReady() bool {
+	for _, e := range s.Endpoints {
+		if e.Ready < e.Minimum {
+			return false
+		}
+	}
+	return true
+}
+
+// AcknowledgementsAnnotation on a Health acknowledges the failures of its
+// components. The value is a JSON object mapping "app/component" to who
+// acknowledged the failure and a note, e.g.
+// {"nova/api": {"by": "alice", "note": "looking into it"}}.
+const AcknowledgementsAnnotation = "common.amadev.ru/acknowledgements"
+
+// AcknowledgementRequest is an entry of AcknowledgementsAnnotation
+type AcknowledgementRequest struct {
+	// By is who acknowledges the failure
+	By string `json:"by"`
+	// Note left with the acknowledgement
+	// +optional
+	Note string `json:"note,omitempty"`
+}
+
+// ParseAcknowledgements parses the value of AcknowledgementsAnnotation, an
+// empty value has no acknowledgements
+func ParseAcknowledgements(value string) (map[string]AcknowledgementRequest, error) {
+	requests := map[string]AcknowledgementRequest{}
+	if value == "" {
+		return requests, nil
+	}
+	if err := json.Unmarshal([]byte(value), &requests); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", AcknowledgementsAnnotation, err)
+	}
+	return requests, nil
+}
+
+// Acknowledgement records that someone is handling the failure of a component
+type Acknowledgement struct {
+	// By is who acknowledged the failure
+	By string `json:"by"`
+	// Note left with the acknowledgement
+	// +optional
+	Note string `json:"note,omitempty"`
+	// Time the acknowledgement was recorded
+	Time metav1.Time `json:"time"`
+	// Failure is the status and reason of the acknowledged failure, as
+	// "status/reason" or only the status without a reason. A different
+	// failure clears the acknowledgement.
+	Failure string `json:"failure"`
+}
+
+// ApplicationStatus maps component names to their observed state
+type ApplicationStatus map[string]ComponentStatus
+
+// HealthStatus defines the observed state of Health. Applications are
+// serialized inline, keyed by application name, next to the other fields,
+// so the field names below cannot be used as application names.
+// +kubebuilder:pruning:PreserveUnknownFields
 type HealthStatus struct {
+	// Applications maps application names to the status of their components
+	Applications map[string]ApplicationStatus `json:"-"`
+	// Rollup of the namespace and its applications, calculated from the
+	// criticality of the components
+	// +optional
+	Rollup *RollupStatus `json:"rollup,omitempty"`
+	// Conditions of the namespace health
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// RollupStatus is the rolled up state of the components of a namespace
+type RollupStatus struct {
+	// Status of the namespace, one of "ready", "unknown", "degraded" or
+	// "down"
+	Status string `json:"status"`
+	// Applications maps application names to their rollup status
+	// +optional
+	Applications map[string]string `json:"applications,omitempty"`
+	// Down lists the first unhealthy components making the rollup down
+	// +optional
+	Down []string `json:"down,omitempty"`
+	// Degraded lists the first unhealthy components making the rollup degraded
+	// +optional
+	Degraded []string `json:"degraded,omitempty"`
+	// Unknown lists the first unknown components which would make the
+	// rollup down or degraded if they were unhealthy
+	// +optional
+	Unknown []string `json:"unknown,omitempty"`
+	// MTTR maps application names to the mean time to recovery of the
+	// ended incidents of their components
+	// +optional
+	MTTR map[string]string `json:"mttr,omitempty"`
+}
+
+// healthStatusFields has the same fields as HealthStatus without the custom
+// JSON encoding
+type healthStatusFields HealthStatus
+
+// reservedStatusFields are the JSON keys of HealthStatus which are not
+// application names
+var reservedStatusFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(HealthStatus{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// ReservedApplication reports whether name is a field of HealthStatus and
+// can not be used as an application name
+func ReservedApplication(name string) bool {
+	return reservedStatusFields[name]
+}
+
+// MarshalJSON implements json.Marshaler
+func (s HealthStatus) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(healthStatusFields(s))
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for app, components := range s.Applications {
+		if reservedStatusFields[app] {
+			continue
+		}
+		data, err := json.Marshal(components)
+		if err != nil {
+			return nil, err
+		}
+		fields[app] = data
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *HealthStatus) UnmarshalJSON(data []byte) error {
+	fields := healthStatusFields{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = HealthStatus(fields)
+	for key, value := range raw {
+		if reservedStatusFields[key] {
+			continue
+		}
+		app := ApplicationStatus{}
+		if err := json.Unmarshal(value, &app); err != nil {
+			return err
+		}
+		if s.Applications == nil {
+			s.Applications = map[string]ApplicationStatus{}
+		}
+		s.Applications[key] = app
+	}
+	return nil
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.rollup.status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Health is the Schema for the healths API
 type Health struct {
@@ -0,0 +1,89 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestHealthStatusWireFormat pins the status layout written before
+// conditions were added, applications keyed inline by their name
+func TestHealthStatusWireFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		status HealthStatus
+	}{
+		{
+			name: "applications only",
+			data: `{"nova":{"api":{"status":"ready","generation":2}}}`,
+			status: HealthStatus{Applications: map[string]ApplicationStatus{
+				"nova": {"api": {Status: StatusReady, Generation: 2}},
+			}},
+		},
+		{
+			name: "applications next to conditions and rollup",
+			data: `{"conditions":[{"type":"PermissionsGranted","status":"True","reason":"AllPermissionsGranted","lastTransitionTime":null}],` +
+				`"nova":{"api":{"status":"down","generation":1}},"rollup":{"status":"down"}}`,
+			status: HealthStatus{
+				Applications: map[string]ApplicationStatus{
+					"nova": {"api": {Status: StatusDown, Generation: 1}},
+				},
+				Rollup:     &RollupStatus{Status: StatusDown},
+				Conditions: []Condition{{Type: "PermissionsGranted", Status: "True", Reason: "AllPermissionsGranted"}},
+			},
+		},
+		{
+			name:   "empty",
+			data:   `{}`,
+			status: HealthStatus{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := HealthStatus{}
+			if err := json.Unmarshal([]byte(test.data), &status); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(status, test.status) {
+				t.Errorf("status %+v, want %+v", status, test.status)
+			}
+			data, err := json.Marshal(status)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if string(data) != test.data {
+				t.Errorf("marshaled %s, want %s", data, test.data)
+			}
+		})
+	}
+}
+
+func TestHealthStatusReservedNames(t *testing.T) {
+	status := HealthStatus{Applications: map[string]ApplicationStatus{
+		"rollup": {"api": {Status: StatusReady}},
+	}}
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{}` {
+		t.Errorf("marshaled %s, reserved names must not be written", data)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthCheckSpec defines the desired state of HealthCheck. Exactly one of
+// the probes must be set.
+type HealthCheckSpec struct {
+	// Application the result is reported for, parsed from the name of the
+	// HealthCheck like for workloads when empty
+	// +optional
+	Application string `json:"application,omitempty"`
+	// Component the result is reported as, the name of the HealthCheck
+	// when empty
+	// +optional
+	Component string `json:"component,omitempty"`
+	// Interval between probes, 30s by default
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Timeout of a probe, 5s by default and 5m for Job checks
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// HTTP probe
+	// +optional
+	HTTP *HTTPProbe `json:"http,omitempty"`
+	// TCP probe
+	// +optional
+	TCP *TCPProbe `json:"tcp,omitempty"`
+	// GRPC probe using the gRPC health checking protocol
+	// +optional
+	GRPC *GRPCProbe `json:"grpc,omitempty"`
+	// Job runs a container as a Job, the check succeeds when the Job does
+	// +optional
+	Job *JobProbe `json:"job,omitempty"`
+}
+
+// HTTPProbe requests a path of a Service in the namespace of the HealthCheck
+type HTTPProbe struct {
+	// Service name
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Service string `json:"service"`
+	// Port of the Service
+	Port int32 `json:"port"`
+	// Path of the request with an optional query, "/" by default
+	// +kubebuilder:validation:Pattern=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Scheme is http or https, http by default. Certificates are not
+	// verified.
+	// +kubebuilder:validation:Enum=http;https
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+	// ExpectedStatusCodes are the successful response codes, any code
+	// from 200 to 399 by default
+	// +optional
+	ExpectedStatusCodes []int32 `json:"expectedStatusCodes,omitempty"`
+	// BodyRegex must match the response body when set
+	// +optional
+	BodyRegex string `json:"bodyRegex,omitempty"`
+	// LatencyBudget fails the probe when the response takes longer
+	// +optional
+	LatencyBudget *metav1.Duration `json:"latencyBudget,omitempty"`
+}
+
+// TCPProbe connects to a port of a Service in the namespace of the HealthCheck
+type TCPProbe struct {
+	// Service name
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Service string `json:"service"`
+	// Port of the Service
+	Port int32 `json:"port"`
+}
+
+// GRPCProbe calls the grpc.health.v1.Health/Check method of a Service in
+// the namespace of the HealthCheck
+type GRPCProbe struct {
+	// Service name
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=63
+	Service string `json:"service"`
+	// Port of the Service
+	Port int32 `json:"port"`
+	// HealthService is the name of the service passed in the request, the
+	// overall server health when empty
+	// +optional
+	HealthService string `json:"healthService,omitempty"`
+}
+
+// JobProbe runs a user supplied container as a Job in the namespace of the
+// HealthCheck, for checks needing client tools
+type JobProbe struct {
+	// Container running the check. Its termination message, or the end of
+	// its log when it fails without one, is recorded as the output.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Container corev1.Container `json:"container"`
+	// ServiceAccountName the pod runs as, it must be listed in the
+	// --check-service-accounts flag of the operator. The pod runs as the
+	// default ServiceAccount without a token when empty.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// HistoryLimit is the number of finished Jobs kept, 3 by default
+	// +optional
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// HealthCheckStatus defines the observed state of HealthCheck
+type HealthCheckStatus struct {
+	// Status of the last probe, either "ready" or "notready"
+	// +optional
+	Status string `json:"status,omitempty"`
+	// Reason is a machine readable explanation of a failure
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable explanation of a failure
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Latency of the last probe, the duration of the Job for Job checks
+	// +optional
+	Latency *metav1.Duration `json:"latency,omitempty"`
+	// Output of the last Job, truncated
+	// +optional
+	Output string `json:"output,omitempty"`
+	// LastJob is the name of the last Job whose result was recorded
+	// +optional
+	LastJob string `json:"lastJob,omitempty"`
+	// LastProbeTime is when the last probe was run
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+	// ObservedGeneration is the generation of the spec the last probe ran with
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
+// +kubebuilder:printcolumn:name="Last Probe",type=date,JSONPath=`.status.lastProbeTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// HealthCheck is the Schema for the healthchecks API
+type HealthCheck struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HealthCheckSpec   `json:"spec,omitempty"`
+	Status HealthCheckStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthCheckList contains a list of HealthCheck
+type HealthCheckList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthCheck `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthCheck{}, &HealthCheckList{})
+}
@@ -0,0 +1,86 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthSilenceSpec defines the desired state of HealthSilence
+type HealthSilenceSpec struct {
+	// Components lists the silenced applications ("app") and components
+	// ("app/component") of the Health in the namespace. Shell patterns
+	// like "nova/*-api" are allowed.
+	// +kubebuilder:validation:MinItems=1
+	Components []string `json:"components"`
+	// StartsAt is when the silence starts, its creation by default
+	// +optional
+	StartsAt *metav1.Time `json:"startsAt,omitempty"`
+	// EndsAt is when the silence ends, it is deleted afterwards
+	EndsAt metav1.Time `json:"endsAt"`
+	// Comment explains the silence, e.g. the planned maintenance
+	// +optional
+	Comment string `json:"comment,omitempty"`
+}
+
+const (
+	// SilencePending is the state of a silence which has not started yet
+	SilencePending = "pending"
+	// SilenceActive is the state of a silence in its time range
+	SilenceActive = "active"
+)
+
+// HealthSilenceStatus defines the observed state of HealthSilence
+type HealthSilenceStatus struct {
+	// State is either "pending" or "active"
+	// +optional
+	State string `json:"state,omitempty"`
+	// Silenced lists the first components silenced while active
+	// +optional
+	Silenced []string `json:"silenced,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Ends",type=string,JSONPath=`.spec.endsAt`
+// +kubebuilder:printcolumn:name="Comment",type=string,JSONPath=`.spec.comment`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// HealthSilence is the Schema for the healthsilences API. Components of
+// the namespace Health matching an active silence are still evaluated but
+// marked as silenced and left out of rollups.
+type HealthSilence struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HealthSilenceSpec   `json:"spec,omitempty"`
+	Status HealthSilenceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthSilenceList contains a list of HealthSilence
+type HealthSilenceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthSilence `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthSilence{}, &HealthSilenceList{})
+}
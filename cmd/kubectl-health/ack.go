@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func runAck(args []string) error {
+	var o options
+	var by, note string
+	fs := flag.NewFlagSet("ack", flag.ExitOnError)
+	o.bind(fs)
+	fs.StringVar(&by, "by", os.Getenv("USER"), "Who acknowledges the failure.")
+	fs.StringVar(&note, "note", "", "A note left with the acknowledgement.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if o.app == "" || o.component == "" {
+		return fmt.Errorf("--app and --component are required")
+	}
+	if by == "" {
+		return fmt.Errorf("--by is required")
+	}
+
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	// the annotation holds all acknowledgements, the resource version makes
+	// concurrent changes conflict instead of overwriting each other
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		health, err := c.get(context.Background())
+		if err != nil {
+			return err
+		}
+		patch, err := acknowledgePatch(health, o.app+"/"+o.component, commonv1alpha1.AcknowledgementRequest{By: by, Note: note})
+		if err != nil {
+			return err
+		}
+		return c.rest.Patch(types.MergePatchType).
+			Namespace(c.namespace).
+			Resource("healths").
+			Name(c.name).
+			Body(patch).
+			Do(context.Background()).
+			Error()
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("acknowledged %s/%s\n", o.app, o.component)
+	return nil
+}
+
+// acknowledgePatch returns a merge patch adding the acknowledgement of a
+// component to the annotation of health
+func acknowledgePatch(health *commonv1alpha1.Health, component string, request commonv1alpha1.AcknowledgementRequest) ([]byte, error) {
+	requests, err := commonv1alpha1.ParseAcknowledgements(health.Annotations[commonv1alpha1.AcknowledgementsAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	requests[component] = request
+	value, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": health.ResourceVersion,
+			"annotations":     map[string]string{commonv1alpha1.AcknowledgementsAnnotation: string(value)},
+		},
+	})
+}
@@ -0,0 +1,65 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestAcknowledgePatch(t *testing.T) {
+	health := &commonv1alpha1.Health{}
+	health.ResourceVersion = "42"
+	health.Annotations = map[string]string{
+		commonv1alpha1.AcknowledgementsAnnotation: `{"glance/api": {"by": "bob"}}`,
+	}
+	patch, err := acknowledgePatch(health, "nova/api", commonv1alpha1.AcknowledgementRequest{By: "alice", Note: "looking into it"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Metadata struct {
+			ResourceVersion string            `json:"resourceVersion"`
+			Annotations     map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Metadata.ResourceVersion != "42" {
+		t.Errorf("resource version %q, the patch must fail on a concurrent change", decoded.Metadata.ResourceVersion)
+	}
+	requests, err := commonv1alpha1.ParseAcknowledgements(decoded.Metadata.Annotations[commonv1alpha1.AcknowledgementsAnnotation])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]commonv1alpha1.AcknowledgementRequest{
+		"glance/api": {By: "bob"},
+		"nova/api":   {By: "alice", Note: "looking into it"},
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("acknowledgements %v, want %v", requests, want)
+	}
+
+	health.Annotations[commonv1alpha1.AcknowledgementsAnnotation] = "nova/api"
+	if _, err := acknowledgePatch(health, "nova/api", commonv1alpha1.AcknowledgementRequest{By: "alice"}); err == nil {
+		t.Error("invalid annotation overwritten")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+var (
+	scheme         = runtime.NewScheme()
+	parameterCodec = runtime.NewParameterCodec(scheme)
+)
+
+func init() {
+	utilruntime.Must(commonv1alpha1.AddToScheme(scheme))
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	kubeconfig  string
+	kubecontext string
+	namespace   string
+	name        string
+	app         string
+	component   string
+	noColor     bool
+}
+
+func (o *options) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&o.kubecontext, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVar(&o.namespace, "namespace", "", "Namespace of the Health resource. Defaults to the context namespace.")
+	fs.StringVar(&o.namespace, "n", "", "Shorthand for --namespace.")
+	fs.StringVar(&o.name, "name", "health", "Name of the Health resource.")
+	fs.StringVar(&o.app, "app", "", "Only consider components of this application.")
+	fs.StringVar(&o.component, "component", "", "Only consider components with this name.")
+	fs.BoolVar(&o.noColor, "no-color", false, "Disable colored output.")
+}
+
+// healthClient reads a single Health resource from the API server.
+type healthClient struct {
+	rest      rest.Interface
+	namespace string
+	name      string
+}
+
+func (o *options) client() (*healthClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, &clientcmd.ConfigOverrides{CurrentContext: o.kubecontext})
+
+	cfg, err := loader.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	namespace := o.namespace
+	if namespace == "" {
+		namespace, _, err = loader.Namespace()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.GroupVersion = &commonv1alpha1.GroupVersion
+	cfg.APIPath = "/apis"
+	cfg.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	rc, err := rest.RESTClientFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &healthClient{rest: rc, namespace: namespace, name: o.name}, nil
+}
+
+func (c *healthClient) get(ctx context.Context) (*commonv1alpha1.Health, error) {
+	health := &commonv1alpha1.Health{}
+	err := c.rest.Get().
+		Namespace(c.namespace).
+		Resource("healths").
+		Name(c.name).
+		Do(ctx).
+		Into(health)
+	if err != nil {
+		return nil, err
+	}
+	health.SetGroupVersionKind(commonv1alpha1.GroupVersion.WithKind("Health"))
+	return health, nil
+}
+
+// watch calls fn with the current Health and then with every update until
+// fn reports that it is done, fn fails or ctx is cancelled. Watches closed
+// by the server are transparently re-established.
+func (c *healthClient) watch(ctx context.Context, fn func(*commonv1alpha1.Health) (bool, error)) error {
+	for {
+		health, err := c.get(ctx)
+		if err != nil {
+			return err
+		}
+		done, err := fn(health)
+		if err != nil || done {
+			return err
+		}
+
+		w, err := c.rest.Get().
+			Namespace(c.namespace).
+			Resource("healths").
+			VersionedParams(&metav1.ListOptions{
+				FieldSelector:   fields.OneTermEqualSelector("metadata.name", c.name).String(),
+				ResourceVersion: health.ResourceVersion,
+				Watch:           true,
+			}, parameterCodec).
+			Watch(ctx)
+		if err != nil {
+			return err
+		}
+		done, err = c.consume(ctx, w, fn)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (c *healthClient) consume(ctx context.Context, w watch.Interface, fn func(*commonv1alpha1.Health) (bool, error)) (bool, error) {
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				health, ok := event.Object.(*commonv1alpha1.Health)
+				if !ok {
+					continue
+				}
+				health.SetGroupVersionKind(commonv1alpha1.GroupVersion.WithKind("Health"))
+				if done, err := fn(health); err != nil || done {
+					return done, err
+				}
+			case watch.Deleted:
+				return false, fmt.Errorf("health %s/%s was deleted", c.namespace, c.name)
+			case watch.Error:
+				err := errors.FromObject(event.Object)
+				if errors.IsResourceExpired(err) || errors.IsGone(err) {
+					return false, nil
+				}
+				return false, err
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const diffUsage = `Usage:
+  kubectl health diff BEFORE [AFTER] [flags]
+
+BEFORE and AFTER are snapshots saved with "kubectl health status -o yaml"
+or "kubectl get health -o yaml". When AFTER is omitted, BEFORE is compared
+with the live Health resource.
+
+Flags:
+`
+
+func runDiff(args []string) error {
+	var o options
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	o.bind(fs)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), diffUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return fmt.Errorf("expected one or two snapshots, got %d", fs.NArg())
+	}
+
+	before, err := o.loadSnapshot(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var after *commonv1alpha1.Health
+	if fs.NArg() == 2 {
+		after, err = o.loadSnapshot(fs.Arg(1))
+	} else {
+		var c *healthClient
+		c, err = o.client()
+		if err == nil {
+			after, err = c.get(context.Background())
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	colors := o.colorizer()
+	old := map[string]row{}
+	for _, r := range o.rows(before) {
+		old[r.key()] = r
+	}
+	changes := 0
+	for _, r := range o.rows(after) {
+		prev, ok := old[r.key()]
+		delete(old, r.key())
+		switch {
+		case !ok:
+			fmt.Printf("%s %s  %s (generation %d)\n",
+				colors.paint(colorGreen, "+"), r.key(), colors.status(r.Status), r.Generation)
+		case prev.Status != r.Status || prev.Generation != r.Generation:
+			fmt.Printf("%s %s  %s -> %s (generation %d -> %d)\n",
+				colors.paint(colorYellow, "~"), r.key(),
+				colors.status(prev.Status), colors.status(r.Status), prev.Generation, r.Generation)
+		default:
+			continue
+		}
+		changes++
+	}
+	for _, r := range o.rows(before) {
+		if _, ok := old[r.key()]; ok {
+			fmt.Printf("%s %s  %s (generation %d)\n",
+				colors.paint(colorRed, "-"), r.key(), colors.status(r.Status), r.Generation)
+			changes++
+		}
+	}
+	if changes == 0 {
+		fmt.Println("No changes.")
+	}
+	return nil
+}
+
+// loadSnapshot reads a Health resource from a JSON or YAML file. Lists as
+// produced by "kubectl get health -o yaml" are accepted as well, in which
+// case the item with the configured name is used.
+func (o *options) loadSnapshot(path string) (*commonv1alpha1.Health, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	health := &commonv1alpha1.Health{}
+	if err := yaml.Unmarshal(data, health); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if !strings.HasSuffix(health.Kind, "List") {
+		return health, nil
+	}
+
+	list := &commonv1alpha1.HealthList{}
+	if err := yaml.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range list.Items {
+		if list.Items[i].Name == o.name {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no Health named %q found", path, o.name)
+}
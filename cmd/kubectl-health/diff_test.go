@@ -0,0 +1,95 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	single := `apiVersion: common.amadev.ru/v1alpha1
+kind: Health
+metadata:
+  name: health
+  namespace: openstack
+status:
+  nova:
+    api:
+      generation: 2
+      status: ready
+`
+	list := `apiVersion: v1
+kind: List
+items:
+- apiVersion: common.amadev.ru/v1alpha1
+  kind: Health
+  metadata:
+    name: other
+- apiVersion: common.amadev.ru/v1alpha1
+  kind: Health
+  metadata:
+    name: health
+  status:
+    nova:
+      api:
+        status: notready
+`
+	tests := []struct {
+		name    string
+		content string
+		status  string
+		invalid bool
+	}{
+		{name: "single", content: single, status: "ready"},
+		{name: "json", content: `{"kind": "Health", "status": {"nova": {"api": {"status": "ready"}}}}`, status: "ready"},
+		{name: "list", content: list, status: "notready"},
+		{name: "list without the Health", content: "kind: List\nitems: []\n", invalid: true},
+		{name: "invalid", content: "status: [", invalid: true},
+	}
+	o := options{name: "health"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "snapshot.yaml")
+			if err := ioutil.WriteFile(path, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			health, err := o.loadSnapshot(path)
+			if (err != nil) != test.invalid {
+				t.Fatalf("error %v, want error %v", err, test.invalid)
+			}
+			if err != nil {
+				return
+			}
+			if status := health.Status.Applications["nova"]["api"].Status; status != test.status {
+				t.Errorf("status %q, want %q", status, test.status)
+			}
+		})
+	}
+
+	if _, err := o.loadSnapshot(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("missing snapshot loaded")
+	}
+}
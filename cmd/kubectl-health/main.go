@@ -0,0 +1,70 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-health is a kubectl plugin for inspecting and waiting on the
+// Health resources maintained by the health operator.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Inspect and wait on Health resources.
+
+Usage:
+  kubectl health <command> [flags]
+
+Commands:
+  status   Show a table of applications and components
+  wait     Wait until components reach a status
+  watch    Print component status transitions as they happen
+  diff     Compare Health snapshots taken at two points in time
+  ack      Acknowledge the failure of a component
+
+Use "kubectl health <command> -h" for more information about a command.
+`
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"status": runStatus,
+	"wait":   runWait,
+	"watch":  runWatch,
+	"diff":   runDiff,
+	"ack":    runAck,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// row is a single component of a Health resource.
+type row struct {
+	app       string
+	component string
+	// healthy is whether the component counts as healthy under the
+	// policies of the Health spec
+	healthy bool
+	commonv1alpha1.ComponentStatus
+}
+
+func (r row) key() string {
+	return r.app + "/" + r.component
+}
+
+// details is a one line explanation of the component status
+func (r row) details() string {
+	var details []string
+	if r.Reason != "" {
+		reason := r.Reason
+		if r.Message != "" {
+			reason += ": " + r.Message
+		}
+		details = append(details, reason)
+	}
+	if r.PendingStatus != "" {
+		details = append(details, fmt.Sprintf("%s since %s", r.PendingStatus, r.PendingSince.UTC().Format(time.RFC3339)))
+	}
+	if r.Flapping {
+		details = append(details, "flapping")
+	}
+	if r.SilencedBy != "" {
+		details = append(details, "silenced by "+r.SilencedBy)
+	}
+	if a := r.Acknowledgement; a != nil {
+		ack := "acknowledged by " + a.By
+		if a.Note != "" {
+			ack += ": " + a.Note
+		}
+		details = append(details, ack)
+	}
+	if ro := r.Rollout; ro != nil && ro.Started != nil && ro.Finished == nil {
+		rollout := "rolling out"
+		if ro.Revision != "" {
+			rollout += " revision " + ro.Revision
+		}
+		details = append(details, rollout+" since "+ro.Started.UTC().Format(time.RFC3339))
+	}
+	if len(r.ImpactedBy) > 0 {
+		details = append(details, "impacted by "+strings.Join(r.ImpactedBy, " "))
+	}
+	for _, d := range r.Diagnostics {
+		details = append(details, fmt.Sprintf("%s (%d pods)", d.Reason, d.Pods))
+	}
+	if d := r.DaemonSet; d != nil && (d.Ready < d.Desired || d.Misscheduled > 0) {
+		details = append(details, fmt.Sprintf("%d/%d nodes ready", d.Ready, d.Desired))
+		if d.Misscheduled > 0 {
+			details = append(details, fmt.Sprintf("%d misscheduled", d.Misscheduled))
+		}
+		if len(d.MissingNodes) > 0 {
+			details = append(details, "missing on "+strings.Join(d.MissingNodes, " "))
+		}
+	}
+	for _, v := range r.Volumes {
+		details = append(details, fmt.Sprintf("claim %s %s", v.Claim, v.Reason))
+	}
+	services := make([]string, 0, len(r.Endpoints))
+	for service := range r.Endpoints {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		if e := r.Endpoints[service]; e.Ready < e.Minimum {
+			details = append(details, fmt.Sprintf("service %s has %d of %d ready endpoints", service, e.Ready, e.Minimum))
+		}
+	}
+	return strings.Join(details, ", ")
+}
+
+// rows flattens the status of health into components sorted by application
+// and component name, keeping only the ones selected by the options. A
+// component whose Service lacks ready endpoints is shown as notready, one
+// which was not evaluated for longer than StaleAfter as unknown.
+func (o *options) rows(health *commonv1alpha1.Health) []row {
+	var rows []row
+	now := time.Now()
+	for app, components := range health.Status.Applications {
+		if o.app != "" && o.app != app {
+			continue
+		}
+		for component, status := range components {
+			if o.component != "" && o.component != component {
+				continue
+			}
+			if (status.Status == commonv1alpha1.StatusReady || status.Status == commonv1alpha1.StatusPartiallyRolled) && !status.IsReady() {
+				status.Status = commonv1alpha1.StatusNotReady
+			}
+			// the operator marks stale components itself unless it is not
+			// running
+			if health.Spec.Stale(status, now) && status.Status != commonv1alpha1.StatusUnknown {
+				status.Message = fmt.Sprintf("%s when last evaluated at %s", status.Status, status.LastEvaluated.UTC().Format(time.RFC3339))
+				status.Status = commonv1alpha1.StatusUnknown
+				status.Reason = "Stale"
+			}
+			rows = append(rows, row{app: app, component: component, healthy: health.Spec.Healthy(status), ComponentStatus: status})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].app != rows[j].app {
+			return rows[i].app < rows[j].app
+		}
+		return rows[i].component < rows[j].component
+	})
+	return rows
+}
+
+// colorizer wraps text into terminal color codes when enabled.
+type colorizer bool
+
+func (o *options) colorizer() colorizer {
+	if o.noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (c colorizer) paint(color, text string) string {
+	if !c {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (c colorizer) status(status string) string {
+	switch status {
+	case commonv1alpha1.StatusReady:
+		return c.paint(colorGreen, status)
+	case commonv1alpha1.StatusNotReady:
+		return c.paint(colorRed, status)
+	default:
+		return c.paint(colorYellow, status)
+	}
+}
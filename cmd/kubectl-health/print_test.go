@@ -0,0 +1,163 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestRows(t *testing.T) {
+	evaluated := metav1.NewTime(time.Now().Add(-time.Hour))
+	health := &commonv1alpha1.Health{}
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"scheduler": {Status: commonv1alpha1.StatusReady},
+			"api": {
+				Status:    commonv1alpha1.StatusReady,
+				Endpoints: map[string]commonv1alpha1.EndpointStatus{"nova-api": {Ready: 0, Minimum: 1}},
+			},
+			"conductor": {Status: commonv1alpha1.StatusReady, LastEvaluated: &evaluated},
+		},
+		"glance": {
+			"api": {Status: commonv1alpha1.StatusNotReady, Reason: "MinimumReplicasUnavailable"},
+		},
+	}
+	tests := []struct {
+		name    string
+		options options
+		rows    []string
+	}{
+		{
+			name: "all",
+			rows: []string{
+				"glance/api notready false",
+				"nova/api notready false",
+				"nova/conductor unknown false",
+				"nova/scheduler ready true",
+			},
+		},
+		{name: "application", options: options{app: "nova"}, rows: []string{"nova/api notready false", "nova/conductor unknown false", "nova/scheduler ready true"}},
+		{name: "component", options: options{component: "api"}, rows: []string{"glance/api notready false", "nova/api notready false"}},
+		{name: "none", options: options{app: "keystone"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var rows []string
+			for _, r := range test.options.rows(health) {
+				rows = append(rows, fmt.Sprintf("%s %s %v", r.key(), r.Status, r.healthy))
+			}
+			if !reflect.DeepEqual(rows, test.rows) {
+				t.Errorf("rows %v, want %v", rows, test.rows)
+			}
+		})
+	}
+
+	var o options
+	for _, r := range o.rows(health) {
+		if r.key() == "nova/conductor" && (r.Reason != "Stale" || r.Message != "ready when last evaluated at "+evaluated.UTC().Format(time.RFC3339)) {
+			t.Errorf("stale component with reason %q and message %q", r.Reason, r.Message)
+		}
+	}
+}
+
+func TestDetails(t *testing.T) {
+	since := metav1.NewTime(time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name    string
+		status  commonv1alpha1.ComponentStatus
+		details string
+	}{
+		{name: "healthy", status: commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady}},
+		{
+			name:    "reason and message",
+			status:  commonv1alpha1.ComponentStatus{Reason: "ProbeFailed", Message: "status code 503"},
+			details: "ProbeFailed: status code 503",
+		},
+		{
+			name:    "pending",
+			status:  commonv1alpha1.ComponentStatus{PendingStatus: commonv1alpha1.StatusNotReady, PendingSince: &since, Flapping: true},
+			details: "notready since 2020-09-01T10:00:00Z, flapping",
+		},
+		{
+			name: "silenced and acknowledged",
+			status: commonv1alpha1.ComponentStatus{
+				SilencedBy:      "upgrade",
+				Acknowledgement: &commonv1alpha1.Acknowledgement{By: "alice", Note: "looking into it"},
+			},
+			details: "silenced by upgrade, acknowledged by alice: looking into it",
+		},
+		{
+			name:    "rollout",
+			status:  commonv1alpha1.ComponentStatus{Rollout: &commonv1alpha1.Rollout{Revision: "5d8f7c9b6", Started: &since}},
+			details: "rolling out revision 5d8f7c9b6 since 2020-09-01T10:00:00Z",
+		},
+		{
+			name: "pods and volumes",
+			status: commonv1alpha1.ComponentStatus{
+				ImpactedBy:  []string{"mariadb/server"},
+				Diagnostics: []commonv1alpha1.PodDiagnostic{{Reason: "CrashLoopBackOff", Pods: 2}},
+				Volumes:     []commonv1alpha1.VolumeDiagnostic{{Claim: "data-mariadb-server-0", Reason: "Pending"}},
+			},
+			details: "impacted by mariadb/server, CrashLoopBackOff (2 pods), claim data-mariadb-server-0 Pending",
+		},
+		{
+			name:    "daemonset",
+			status:  commonv1alpha1.ComponentStatus{DaemonSet: &commonv1alpha1.DaemonSetCounts{Desired: 3, Ready: 2, Misscheduled: 1, MissingNodes: []string{"cmp-2"}}},
+			details: "2/3 nodes ready, 1 misscheduled, missing on cmp-2",
+		},
+		{
+			name: "endpoints",
+			status: commonv1alpha1.ComponentStatus{Endpoints: map[string]commonv1alpha1.EndpointStatus{
+				"nova-metadata": {Ready: 0, Minimum: 1},
+				"nova-api":      {Ready: 1, Minimum: 2},
+				"nova-os-api":   {Ready: 2, Minimum: 2},
+			}},
+			details: "service nova-api has 1 of 2 ready endpoints, service nova-metadata has 0 of 1 ready endpoints",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := row{app: "nova", component: "api", ComponentStatus: test.status}
+			if details := r.details(); details != test.details {
+				t.Errorf("details %q, want %q", details, test.details)
+			}
+		})
+	}
+}
+
+func TestColorizer(t *testing.T) {
+	if status := colorizer(false).status(commonv1alpha1.StatusNotReady); status != commonv1alpha1.StatusNotReady {
+		t.Errorf("uncolored status %q", status)
+	}
+	tests := map[string]string{
+		commonv1alpha1.StatusReady:    colorGreen,
+		commonv1alpha1.StatusNotReady: colorRed,
+		commonv1alpha1.StatusUnknown:  colorYellow,
+	}
+	for status, color := range tests {
+		if painted := colorizer(true).status(status); painted != color+status+colorReset {
+			t.Errorf("status %q painted %q", status, painted)
+		}
+	}
+}
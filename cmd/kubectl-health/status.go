@@ -0,0 +1,94 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func runStatus(args []string) error {
+	var o options
+	var output string
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	o.bind(fs)
+	fs.StringVar(&output, "o", "table", "Output format: table, json or yaml. json and yaml output can be used as a snapshot for diff.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	health, err := c.get(context.Background())
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(health, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(health)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "table":
+		rows := o.rows(health)
+		if len(rows) == 0 {
+			fmt.Printf("No components found in %s/%s.\n", c.namespace, c.name)
+			return nil
+		}
+		colors := o.colorizer()
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLICATION\tCOMPONENT\tGENERATION\tSTATUS\tDETAILS")
+		for _, r := range rows {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.app, r.component, r.Generation, colors.status(r.Status), r.details())
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if rollup := health.Status.Rollup; rollup != nil && (o.app == "" || rollup.Applications[o.app] != "") {
+			status := rollup.Status
+			if o.app != "" {
+				status = rollup.Applications[o.app]
+			}
+			fmt.Printf("Rollup: %s\n", colors.status(status))
+		}
+		for _, condition := range health.Status.Conditions {
+			if condition.Status != metav1.ConditionTrue {
+				fmt.Printf("%s %s: %s\n", colors.paint(colorRed, "!"), condition.Type, condition.Message)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func runWait(args []string) error {
+	var o options
+	var status string
+	var timeout time.Duration
+	fs := flag.NewFlagSet("wait", flag.ExitOnError)
+	o.bind(fs)
+	fs.StringVar(&status, "for", commonv1alpha1.StatusReady, "The status to wait for.")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "How long to wait before giving up. Zero means wait forever.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// pending is kept from the last observed Health to explain a timeout.
+	var pending []string
+	err = c.watch(ctx, func(health *commonv1alpha1.Health) (bool, error) {
+		rows := o.rows(health)
+		pending = pending[:0]
+		for _, r := range rows {
+			// scaled down and paused components are ready if the
+			// policies of the Health spec count them as healthy
+			met := r.Status == status
+			if status == commonv1alpha1.StatusReady {
+				met = r.healthy
+			}
+			if !met {
+				pending = append(pending, fmt.Sprintf("%s (%s)", r.key(), r.Status))
+			}
+		}
+		return len(rows) > 0 && len(pending) == 0, nil
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		if len(pending) == 0 {
+			return fmt.Errorf("timed out waiting for components to appear in %s/%s", c.namespace, c.name)
+		}
+		return fmt.Errorf("timed out waiting for %s: %s", status, strings.Join(pending, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("condition met: %s\n", status)
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func runWatch(args []string) error {
+	var o options
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	o.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := o.client()
+	if err != nil {
+		return err
+	}
+
+	colors := o.colorizer()
+	seen := map[string]row{}
+	return c.watch(context.Background(), func(health *commonv1alpha1.Health) (bool, error) {
+		now := time.Now().Format(time.RFC3339)
+		for _, r := range o.rows(health) {
+			prev, ok := seen[r.key()]
+			switch {
+			case !ok:
+				fmt.Printf("%s  %s  %s (generation %d)\n",
+					now, r.key(), colors.status(r.Status), r.Generation)
+			case prev.Status != r.Status:
+				fmt.Printf("%s  %s  %s -> %s (generation %d)\n",
+					now, r.key(), colors.status(prev.Status), colors.status(r.Status), r.Generation)
+			}
+			seen[r.key()] = r
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,99 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// failureKey identifies a failure of a component by its status and reason
+func failureKey(status commonv1alpha1.ComponentStatus) string {
+	if status.Reason == "" {
+		return status.Status
+	}
+	return status.Status + "/" + status.Reason
+}
+
+// applyAcknowledgements records the acknowledgements annotated on health in
+// its components. An acknowledgement ends when the component recovers or
+// fails differently, the components of ended ones are returned for removal
+// from the annotation. Acknowledgements of unknown components are kept.
+func applyAcknowledgements(health *commonv1alpha1.Health, now time.Time) ([]string, error) {
+	requests, err := commonv1alpha1.ParseAcknowledgements(health.Annotations[commonv1alpha1.AcknowledgementsAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	var ended []string
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			key := app + "/" + component
+			request, ok := requests[key]
+			ack := status.Acknowledgement
+			switch {
+			case !ok:
+				status.Acknowledgement = nil
+			case health.Spec.Healthy(status) || (ack != nil && ack.Failure != failureKey(status)):
+				status.Acknowledgement = nil
+				ended = append(ended, key)
+			case ack == nil || ack.By != request.By || ack.Note != request.Note:
+				status.Acknowledgement = &commonv1alpha1.Acknowledgement{
+					By:      request.By,
+					Note:    request.Note,
+					Time:    metav1.NewTime(now),
+					Failure: failureKey(status),
+				}
+			}
+			components[component] = status
+		}
+	}
+	sort.Strings(ended)
+	return ended, nil
+}
+
+// removeAcknowledgementsPatch returns a merge patch removing the
+// acknowledgements of components from the annotation of health. The patch
+// fails when health changed meanwhile, so that concurrent acknowledgements
+// are not lost.
+func removeAcknowledgementsPatch(health *commonv1alpha1.Health, components []string) ([]byte, error) {
+	requests, err := commonv1alpha1.ParseAcknowledgements(health.Annotations[commonv1alpha1.AcknowledgementsAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range components {
+		delete(requests, key)
+	}
+	var value interface{}
+	if len(requests) > 0 {
+		data, err := json.Marshal(requests)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": health.ResourceVersion,
+			"annotations":     map[string]interface{}{commonv1alpha1.AcknowledgementsAnnotation: value},
+		},
+	})
+}
@@ -0,0 +1,140 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestApplyAcknowledgements(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	acked := &commonv1alpha1.Acknowledgement{By: "alice", Time: metav1.NewTime(now.Add(-time.Hour)), Failure: "notready/Unavailable"}
+	notReady := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Reason: "Unavailable"}
+	tests := []struct {
+		name       string
+		annotation string
+		status     commonv1alpha1.ComponentStatus
+		ack        *commonv1alpha1.Acknowledgement
+		ended      []string
+		err        bool
+	}{
+		{
+			name:   "not acknowledged",
+			status: notReady,
+		},
+		{
+			name:       "acknowledged failure",
+			annotation: `{"nova/api.v2": {"by": "alice", "note": "on it"}}`,
+			status:     notReady,
+			ack:        &commonv1alpha1.Acknowledgement{By: "alice", Note: "on it", Time: metav1.NewTime(now), Failure: "notready/Unavailable"},
+		},
+		{
+			name:       "recorded acknowledgement is kept",
+			annotation: `{"nova/api.v2": {"by": "alice"}}`,
+			status:     commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Reason: "Unavailable", Acknowledgement: acked},
+			ack:        acked,
+		},
+		{
+			name:       "recovery ends the acknowledgement",
+			annotation: `{"nova/api.v2": {"by": "alice"}}`,
+			status:     commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Acknowledgement: acked},
+			ended:      []string{"nova/api.v2"},
+		},
+		{
+			name:       "another failure ends the acknowledgement",
+			annotation: `{"nova/api.v2": {"by": "alice"}}`,
+			status:     commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Reason: "MinimumReplicasUnavailable", Acknowledgement: acked},
+			ended:      []string{"nova/api.v2"},
+		},
+		{
+			name:       "removed annotation clears the acknowledgement",
+			annotation: `{}`,
+			status:     commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Reason: "Unavailable", Acknowledgement: acked},
+		},
+		{
+			name:       "invalid annotation",
+			annotation: `nova/api.v2: alice`,
+			status:     notReady,
+			err:        true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			if test.annotation != "" {
+				health.Annotations = map[string]string{commonv1alpha1.AcknowledgementsAnnotation: test.annotation}
+			}
+			health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+				"nova": {"api.v2": test.status},
+			}
+			ended, err := applyAcknowledgements(health, now)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(ended, test.ended) {
+				t.Errorf("ended %v, want %v", ended, test.ended)
+			}
+			if ack := health.Status.Applications["nova"]["api.v2"].Acknowledgement; !reflect.DeepEqual(ack, test.ack) {
+				t.Errorf("acknowledgement %+v, want %+v", ack, test.ack)
+			}
+		})
+	}
+}
+
+func TestRemoveAcknowledgementsPatch(t *testing.T) {
+	health := &commonv1alpha1.Health{}
+	health.ResourceVersion = "42"
+	health.Annotations = map[string]string{
+		commonv1alpha1.AcknowledgementsAnnotation: `{"nova/api": {"by": "alice"}, "nova/scheduler": {"by": "bob", "note": "OOM"}}`,
+	}
+	tests := []struct {
+		components []string
+		value      interface{}
+	}{
+		{components: []string{"nova/api"}, value: `{"nova/scheduler":{"by":"bob","note":"OOM"}}`},
+		{components: []string{"nova/api", "nova/scheduler"}, value: nil},
+	}
+	for _, test := range tests {
+		patch, err := removeAcknowledgementsPatch(health, test.components)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded struct {
+			Metadata struct {
+				ResourceVersion string                 `json:"resourceVersion"`
+				Annotations     map[string]interface{} `json:"annotations"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(patch, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Metadata.ResourceVersion != "42" {
+			t.Errorf("patch %s does not check the resource version", patch)
+		}
+		value, ok := decoded.Metadata.Annotations[commonv1alpha1.AcknowledgementsAnnotation]
+		if !ok || value != test.value {
+			t.Errorf("annotation %v, want %v", value, test.value)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	// maxAvailabilityChanges bounds the changes kept per component
+	maxAvailabilityChanges = 100
+	// availabilityRefresh is how often the percentages are recalculated
+	// without a change, so that rollups do not update the Health every
+	// time they run
+	availabilityRefresh = time.Minute
+)
+
+// availabilityWindows are the rolling windows availability is calculated for
+var availabilityWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+var (
+	availabilityRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_component_availability_ratio",
+		Help: "Share of the window a component was healthy",
+	}, []string{"namespace", "application", "component", "window"})
+	objectiveRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_component_availability_objective_ratio",
+		Help: "Availability objective of a component over 30 days",
+	}, []string{"namespace", "application", "component"})
+	errorBudgetRemainingRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_component_error_budget_remaining_ratio",
+		Help: "Share of the error budget of a component left over 30 days",
+	}, []string{"namespace", "application", "component"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(availabilityRatio, objectiveRatio, errorBudgetRemainingRatio)
+}
+
+// availabilitySeries are the applications and components availability
+// series are set for
+var availabilitySeries metricSeries
+
+// deleteAvailabilityMetrics deletes the availability series of a component
+func deleteAvailabilityMetrics(namespace, app, component string) {
+	for _, window := range availabilityWindows {
+		availabilityRatio.DeleteLabelValues(namespace, app, component, window.name)
+	}
+	objectiveRatio.DeleteLabelValues(namespace, app, component)
+	errorBudgetRemainingRatio.DeleteLabelValues(namespace, app, component)
+}
+
+// objective returns the availability target of a component in percent,
+// configured for the component or its application, and whether there is one
+func objective(spec *commonv1alpha1.HealthSpec, app, component string) (float64, bool) {
+	value, ok := spec.Objectives[app+"/"+component]
+	if !ok {
+		value, ok = spec.Objectives[app]
+	}
+	if !ok {
+		return 0, false
+	}
+	target, err := strconv.ParseFloat(value, 64)
+	if err != nil || target <= 0 || target > 100 {
+		return 0, false
+	}
+	return target, true
+}
+
+// healthyRatio is the share of the window before now the component was
+// healthy, from the changes sorted oldest first. The window starts at the
+// first change at the earliest.
+func healthyRatio(changes []commonv1alpha1.AvailabilityChange, window time.Duration, now time.Time) float64 {
+	start := now.Add(-window)
+	if first := changes[0].Time.Time; first.After(start) {
+		start = first
+	}
+	total := now.Sub(start)
+	if total <= 0 {
+		if changes[len(changes)-1].Healthy {
+			return 1
+		}
+		return 0
+	}
+	var healthy time.Duration
+	for i, change := range changes {
+		end := now
+		if i+1 < len(changes) {
+			end = changes[i+1].Time.Time
+		}
+		from := change.Time.Time
+		if from.Before(start) {
+			from = start
+		}
+		if change.Healthy && end.After(from) {
+			healthy += end.Sub(from)
+		}
+	}
+	return float64(healthy) / float64(total)
+}
+
+// formatPercent formats a ratio as a percentage
+func formatPercent(ratio float64) string {
+	return strconv.FormatFloat(ratio*100, 'f', 3, 64)
+}
+
+// updateAvailability records the changes between healthy and unhealthy of
+// the components of health and recalculates their availability when one
+// changed or the last calculation is older than availabilityRefresh
+func updateAvailability(health *commonv1alpha1.Health, now time.Time) {
+	var series [][]string
+	defer func() {
+		for _, labels := range availabilitySeries.update(health.Namespace, series) {
+			deleteAvailabilityMetrics(health.Namespace, labels[0], labels[1])
+		}
+	}()
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			availability := status.Availability.DeepCopy()
+			changed := false
+			if status.Status != commonv1alpha1.StatusUnknown {
+				healthy := health.Spec.Healthy(status)
+				if availability == nil {
+					availability = &commonv1alpha1.Availability{}
+				}
+				changes := availability.Changes
+				if len(changes) == 0 || changes[len(changes)-1].Healthy != healthy {
+					availability.Changes = append(changes, commonv1alpha1.AvailabilityChange{Time: metav1.NewTime(now), Healthy: healthy})
+					changed = true
+				}
+			}
+			if availability == nil {
+				continue
+			}
+			series = append(series, []string{app, component})
+			target, hasTarget := objective(&health.Spec, app, component)
+			if !changed && now.Sub(availability.Evaluated.Time) < availabilityRefresh && (availability.Objective != "") == hasTarget {
+				continue
+			}
+
+			// changes older than the longest window only matter for
+			// the state at its start
+			oldest := now.Add(-availabilityWindows[len(availabilityWindows)-1].length)
+			changes := availability.Changes
+			for len(changes) > 1 && !changes[1].Time.After(oldest) {
+				changes = changes[1:]
+			}
+			if len(changes) > maxAvailabilityChanges {
+				changes = changes[len(changes)-maxAvailabilityChanges:]
+			}
+			availability.Changes = changes
+
+			ratios := make([]float64, len(availabilityWindows))
+			for i, window := range availabilityWindows {
+				ratios[i] = healthyRatio(changes, window.length, now)
+				availabilityRatio.WithLabelValues(health.Namespace, app, component, window.name).Set(ratios[i])
+			}
+			availability.Hour = formatPercent(ratios[0])
+			availability.Day = formatPercent(ratios[1])
+			availability.Month = formatPercent(ratios[2])
+			availability.Objective = ""
+			availability.ErrorBudgetRemaining = ""
+			if hasTarget {
+				availability.Objective = strconv.FormatFloat(target, 'f', -1, 64)
+				budget := 1 - target/100
+				remaining := 0.0
+				if budget > 0 {
+					remaining = (budget - (1 - ratios[2])) / budget
+				}
+				availability.ErrorBudgetRemaining = formatPercent(remaining)
+				objectiveRatio.WithLabelValues(health.Namespace, app, component).Set(target / 100)
+				errorBudgetRemainingRatio.WithLabelValues(health.Namespace, app, component).Set(remaining)
+			} else {
+				objectiveRatio.DeleteLabelValues(health.Namespace, app, component)
+				errorBudgetRemainingRatio.DeleteLabelValues(health.Namespace, app, component)
+			}
+			availability.Evaluated = metav1.NewTime(now)
+			status.Availability = availability
+			components[component] = status
+		}
+	}
+}
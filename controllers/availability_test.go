@@ -0,0 +1,142 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestHealthyRatio(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	change := func(ago time.Duration, healthy bool) commonv1alpha1.AvailabilityChange {
+		return commonv1alpha1.AvailabilityChange{Time: metav1.NewTime(now.Add(-ago)), Healthy: healthy}
+	}
+	tests := []struct {
+		name    string
+		changes []commonv1alpha1.AvailabilityChange
+		window  time.Duration
+		ratio   float64
+	}{
+		{
+			name:    "healthy since before the window",
+			changes: []commonv1alpha1.AvailabilityChange{change(2*time.Hour, true)},
+			window:  time.Hour,
+			ratio:   1,
+		},
+		{
+			name:    "unhealthy for a quarter of the window",
+			changes: []commonv1alpha1.AvailabilityChange{change(2*time.Hour, true), change(15*time.Minute, false)},
+			window:  time.Hour,
+			ratio:   0.75,
+		},
+		{
+			name:    "window starts at the first change",
+			changes: []commonv1alpha1.AvailabilityChange{change(30*time.Minute, false), change(10*time.Minute, true)},
+			window:  time.Hour,
+			ratio:   float64(10) / 30,
+		},
+		{
+			name:    "changes before the window count for its start",
+			changes: []commonv1alpha1.AvailabilityChange{change(3*time.Hour, false), change(2*time.Hour, true), change(30*time.Minute, false)},
+			window:  time.Hour,
+			ratio:   0.5,
+		},
+		{
+			name:    "tracking just started unhealthy",
+			changes: []commonv1alpha1.AvailabilityChange{change(0, false)},
+			window:  time.Hour,
+			ratio:   0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ratio := healthyRatio(test.changes, test.window, now)
+			if diff := ratio - test.ratio; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("ratio %v, want %v", ratio, test.ratio)
+			}
+		})
+	}
+}
+
+// seriesCount returns the number of series of c
+func seriesCount(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	n := 0
+	for range ch {
+		n++
+	}
+	return n
+}
+
+func TestUpdateAvailability(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	health := &commonv1alpha1.Health{}
+	health.Namespace = "availability-test"
+	health.Spec.Objectives = map[string]string{"nova": "99"}
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Status: commonv1alpha1.StatusReady},
+			"scheduler": {Status: commonv1alpha1.StatusUnknown},
+		},
+	}
+	windows, components := len(availabilityWindows), 1
+	defer deleteHealthMetrics(health.Namespace)
+
+	updateAvailability(health, now)
+	api := health.Status.Applications["nova"]["api"].Availability
+	if api == nil || api.Month != "100.000" || api.Objective != "99" || api.ErrorBudgetRemaining != "100.000" {
+		t.Fatalf("availability %+v", api)
+	}
+	if scheduler := health.Status.Applications["nova"]["scheduler"].Availability; scheduler != nil {
+		t.Errorf("unknown component is tracked %+v", scheduler)
+	}
+	if n := seriesCount(availabilityRatio); n != windows*components {
+		t.Errorf("%d availability series, want %d", n, windows*components)
+	}
+
+	// a change is recorded and recalculated at once
+	status := health.Status.Applications["nova"]["api"]
+	status.Status = commonv1alpha1.StatusNotReady
+	health.Status.Applications["nova"]["api"] = status
+	updateAvailability(health, now.Add(time.Hour))
+	api = health.Status.Applications["nova"]["api"].Availability
+	if len(api.Changes) != 2 || api.Hour != "100.000" || !api.Evaluated.Time.Equal(now.Add(time.Hour)) {
+		t.Errorf("availability %+v", api)
+	}
+
+	// removed objectives and components drop their series
+	health.Spec.Objectives = nil
+	updateAvailability(health, now.Add(2*time.Hour))
+	if n := seriesCount(objectiveRatio); n != 0 {
+		t.Errorf("%d objective series without objectives", n)
+	}
+	delete(health.Status.Applications["nova"], "api")
+	updateAvailability(health, now.Add(3*time.Hour))
+	if n := seriesCount(availabilityRatio); n != 0 {
+		t.Errorf("%d availability series without components", n)
+	}
+}
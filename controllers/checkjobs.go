@@ -0,0 +1,199 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	// HealthCheckLabel is set on Jobs run for a HealthCheck to its name
+	HealthCheckLabel = "common.amadev.ru/healthcheck"
+
+	defaultCheckJobTimeout      = 5 * time.Minute
+	defaultCheckJobHistoryLimit = 3
+	// maxCheckOutput bounds the output of a check Job kept in the status
+	maxCheckOutput = 1024
+	// checkJobsBusyRetry is how long a due Job waits when too many check
+	// Jobs are running
+	checkJobsBusyRetry = 10 * time.Second
+)
+
+// checkJobs lists the Jobs run for check, newest first
+func (r *HealthCheckReconciler) checkJobs(ctx context.Context, check *commonv1alpha1.HealthCheck) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(check.Namespace), client.MatchingLabels{HealthCheckLabel: check.Name})
+	if err != nil {
+		return nil, err
+	}
+	var owned []batchv1.Job
+	for _, job := range jobs.Items {
+		if ref := metav1.GetControllerOf(&job); ref != nil && ref.UID == check.UID {
+			owned = append(owned, job)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[j].CreationTimestamp.Before(&owned[i].CreationTimestamp)
+	})
+	return owned, nil
+}
+
+// runningCheckJobs counts the unfinished check Jobs of all HealthChecks
+func (r *HealthCheckReconciler) runningCheckJobs(ctx context.Context) (int, error) {
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	jobs := &batchv1.JobList{}
+	err := reader.List(ctx, jobs, client.HasLabels{HealthCheckLabel})
+	if err != nil {
+		return 0, err
+	}
+	running := 0
+	for i := range jobs.Items {
+		if finished, _ := jobFinished(&jobs.Items[i]); finished.IsZero() {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// serviceAccountAllowed reports whether check Jobs may run as account. The
+// operator creates the Jobs, so without this list anyone allowed to create
+// a HealthCheck could run pods as any ServiceAccount of the namespace.
+func (r *HealthCheckReconciler) serviceAccountAllowed(account string) bool {
+	for _, allowed := range r.CheckServiceAccounts {
+		if account == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// newCheckJob builds the Job running the container of check. Without a
+// ServiceAccount the pod gets no token.
+func (r *HealthCheckReconciler) newCheckJob(check *commonv1alpha1.HealthCheck, timeout time.Duration) (*batchv1.Job, error) {
+	container := *check.Spec.Job.Container.DeepCopy()
+	if container.Name == "" {
+		container.Name = "check"
+	}
+	if container.TerminationMessagePolicy == "" {
+		container.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	}
+	backoffLimit := int32(0)
+	// the deadline is in whole seconds, a zero deadline would be rejected
+	deadline := int64((timeout + time.Second - 1) / time.Second)
+	if deadline < 1 {
+		deadline = 1
+	}
+	labels := map[string]string{HealthCheckLabel: check.Name}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: check.Name + "-",
+			Namespace:    check.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: check.Spec.Job.ServiceAccountName,
+					Containers:         []corev1.Container{container},
+				},
+			},
+		},
+	}
+	if check.Spec.Job.ServiceAccountName == "" {
+		automount := false
+		job.Spec.Template.Spec.AutomountServiceAccountToken = &automount
+	}
+	err := controllerutil.SetControllerReference(check, job, r.Scheme)
+	return job, err
+}
+
+// checkJobResult returns the result and output of a finished Job
+func (r *HealthCheckReconciler) checkJobResult(ctx context.Context, job *batchv1.Job) (probeResult, string, error) {
+	finished, succeeded := jobFinished(job)
+	result := probeResult{}
+	if job.Status.StartTime != nil {
+		result.latency = finished.Sub(job.Status.StartTime.Time)
+	}
+	if !succeeded {
+		result.reason = "JobFailed"
+		result.message = fmt.Sprintf("job %s failed", job.Name)
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+				result.reason = c.Reason
+				result.message = fmt.Sprintf("job %s failed: %s", job.Name, c.Message)
+			}
+		}
+	}
+
+	pods, err := ownedPods(ctx, r.Client, job.Namespace, job.Spec.Selector, map[types.UID]bool{job.UID: true})
+	if err != nil {
+		return result, "", err
+	}
+	var output string
+	for _, pod := range pods {
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.State.Terminated != nil && s.State.Terminated.Message != "" {
+				output = s.State.Terminated.Message
+			}
+		}
+	}
+	return result, truncateStart(output, maxCheckOutput), nil
+}
+
+// cleanupCheckJobs deletes the finished Jobs beyond the history limit,
+// jobs are sorted newest first
+func (r *HealthCheckReconciler) cleanupCheckJobs(ctx context.Context, check *commonv1alpha1.HealthCheck, jobs []batchv1.Job) error {
+	limit := int32(defaultCheckJobHistoryLimit)
+	if check.Spec.Job.HistoryLimit != nil {
+		limit = *check.Spec.Job.HistoryLimit
+	}
+	kept := int32(0)
+	for i := range jobs {
+		job := &jobs[i]
+		if finished, _ := jobFinished(job); finished.IsZero() {
+			continue
+		}
+		if kept < limit {
+			kept++
+			continue
+		}
+		err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestNewCheckJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		account   string
+		deadline  int64
+		automount bool
+	}{
+		{name: "whole seconds", timeout: 30 * time.Second, deadline: 30},
+		{name: "rounded up", timeout: 1500 * time.Millisecond, deadline: 2},
+		{name: "below a second", timeout: 100 * time.Millisecond, deadline: 1},
+		{name: "zero", deadline: 1},
+		{name: "service account", timeout: time.Minute, account: "tempest", deadline: 60, automount: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			check := &commonv1alpha1.HealthCheck{}
+			check.Name, check.Namespace, check.UID = "tempest", "openstack", "uid"
+			check.Spec.Job = &commonv1alpha1.JobProbe{
+				Container:          corev1.Container{Image: "tempest"},
+				ServiceAccountName: test.account,
+			}
+			r := &HealthCheckReconciler{Scheme: testScheme(t)}
+			job, err := r.newCheckJob(check, test.timeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *job.Spec.ActiveDeadlineSeconds != test.deadline {
+				t.Errorf("deadline %d, want %d", *job.Spec.ActiveDeadlineSeconds, test.deadline)
+			}
+			pod := job.Spec.Template.Spec
+			if automount := pod.AutomountServiceAccountToken == nil || *pod.AutomountServiceAccountToken; automount != test.automount {
+				t.Errorf("token mounted %v, want %v", automount, test.automount)
+			}
+			if pod.ServiceAccountName != test.account {
+				t.Errorf("service account %q, want %q", pod.ServiceAccountName, test.account)
+			}
+			if c := pod.Containers[0]; c.Name != "check" || c.TerminationMessagePolicy != corev1.TerminationMessageFallbackToLogsOnError {
+				t.Errorf("container %s with termination message policy %s", c.Name, c.TerminationMessagePolicy)
+			}
+			if pod.RestartPolicy != corev1.RestartPolicyNever || *job.Spec.BackoffLimit != 0 {
+				t.Error("check jobs must not retry")
+			}
+			if ref := metav1.GetControllerOf(job); ref == nil || ref.UID != check.UID {
+				t.Errorf("controller %v, want the HealthCheck", ref)
+			}
+			if job.Labels[HealthCheckLabel] != check.Name || job.Spec.Template.Labels[HealthCheckLabel] != check.Name {
+				t.Error("job and pod not labeled with the HealthCheck")
+			}
+		})
+	}
+}
+
+func TestCheckJobResult(t *testing.T) {
+	start := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	condition := func(conditionType batchv1.JobConditionType, reason, message string) batchv1.JobCondition {
+		return batchv1.JobCondition{
+			Type:               conditionType,
+			Status:             corev1.ConditionTrue,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.NewTime(start.Add(3 * time.Second)),
+		}
+	}
+	tests := []struct {
+		name      string
+		condition batchv1.JobCondition
+		message   string
+		output    string
+		reason    string
+		contains  string
+	}{
+		{
+			name:      "succeeded",
+			condition: condition(batchv1.JobComplete, "", ""),
+			message:   "all tests passed",
+			output:    "all tests passed",
+		},
+		{
+			name:      "failed",
+			condition: condition(batchv1.JobFailed, "BackoffLimitExceeded", "Job has reached the specified backoff limit"),
+			message:   "test_servers failed",
+			output:    "test_servers failed",
+			reason:    "BackoffLimitExceeded",
+			contains:  "backoff limit",
+		},
+		{
+			name:      "deadline exceeded",
+			condition: condition(batchv1.JobFailed, "DeadlineExceeded", "Job was active longer than specified deadline"),
+			reason:    "DeadlineExceeded",
+			contains:  "deadline",
+		},
+		{
+			name:      "output is truncated at the start",
+			condition: condition(batchv1.JobComplete, "", ""),
+			message:   strings.Repeat("x", maxCheckOutput) + "end",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := &batchv1.Job{}
+			job.Name, job.Namespace, job.UID = "tempest-abc", "openstack", "job"
+			job.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": job.Name}}
+			job.Status.StartTime = &metav1.Time{Time: start}
+			job.Status.Conditions = []batchv1.JobCondition{test.condition}
+
+			controller := true
+			pod := &corev1.Pod{}
+			pod.Name, pod.Namespace = "tempest-abc-xyz", "openstack"
+			pod.Labels = map[string]string{"job-name": job.Name}
+			pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, UID: job.UID, Controller: &controller}}
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "check",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: test.message}},
+			}}
+
+			r := &HealthCheckReconciler{Client: fake.NewFakeClientWithScheme(testScheme(t), pod)}
+			result, output, err := r.checkJobResult(context.Background(), job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.reason != test.reason || !strings.Contains(result.message, test.contains) {
+				t.Errorf("result %+v, want reason %q with a message containing %q", result, test.reason, test.contains)
+			}
+			if result.latency != 3*time.Second {
+				t.Errorf("latency %v, want 3s", result.latency)
+			}
+			if len(output) > maxCheckOutput {
+				t.Errorf("output of %d bytes, at most %d are kept", len(output), maxCheckOutput)
+			}
+			if test.output != "" && output != test.output {
+				t.Errorf("output %q, want %q", output, test.output)
+			}
+			if test.message != "" && !strings.HasSuffix(output, test.message[len(test.message)-3:]) {
+				t.Errorf("output %q lost the end of the message", output)
+			}
+		})
+	}
+}
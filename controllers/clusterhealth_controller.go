@@ -0,0 +1,211 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// ClusterHealthReconciler rolls up the Health of every selected namespace
+// into cluster scoped ClusterHealth objects. Summaries are recalculated
+// from the cache on every Health change and only the difference is
+// patched into the status.
+type ClusterHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=clusterhealths,verbs=get;list;watch
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=clusterhealths/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+func (r *ClusterHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("clusterhealth", req.Name)
+	log.Info("Got reconcile request")
+
+	clusterHealth := &commonv1alpha1.ClusterHealth{}
+	err := r.Get(ctx, req.NamespacedName, clusterHealth)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("ClusterHealth was deleted. Nothing to do")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get ClusterHealth")
+		return ctrl.Result{}, err
+	}
+
+	selected, err := r.selectedNamespaces(ctx, clusterHealth)
+	if err != nil {
+		log.Error(err, "Failed to select namespaces")
+		return ctrl.Result{}, err
+	}
+
+	healths := &commonv1alpha1.HealthList{}
+	err = r.List(ctx, healths)
+	if err != nil {
+		log.Error(err, "Failed to list Health")
+		return ctrl.Result{}, err
+	}
+
+	original := clusterHealth.DeepCopy()
+	summaries := map[string]commonv1alpha1.NamespaceSummary{}
+	var notReady []string
+	for i := range healths.Items {
+		health := &healths.Items[i]
+		if health.Name != "health" {
+			continue
+		}
+		if selected != nil && !selected[health.Namespace] {
+			continue
+		}
+		summary := summarizeHealth(health)
+		summaries[health.Namespace] = summary
+		if summary.Status != commonv1alpha1.StatusReady {
+			notReady = append(notReady, health.Namespace)
+		}
+	}
+	sort.Strings(notReady)
+
+	status := &clusterHealth.Status
+	status.Namespaces = summaries
+	status.Nodes = nil
+	var notReadyNodeGroups []string
+	if clusterHealth.Spec.Nodes != nil {
+		nodes := &corev1.NodeList{}
+		err = r.List(ctx, nodes)
+		if err != nil {
+			log.Error(err, "Failed to list nodes")
+			return ctrl.Result{}, err
+		}
+		status.Nodes = summarizeNodes(nodes.Items, clusterHealth.Spec.Nodes.GroupByLabel)
+		for group, summary := range status.Nodes {
+			if summary.Status != commonv1alpha1.StatusReady {
+				notReadyNodeGroups = append(notReadyNodeGroups, group)
+			}
+		}
+		sort.Strings(notReadyNodeGroups)
+	}
+	condition := commonv1alpha1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionTrue,
+		Reason:             "AllNamespacesReady",
+		Message:            fmt.Sprintf("%d namespaces are ready", len(summaries)),
+		LastTransitionTime: metav1.Now(),
+	}
+	status.Status = commonv1alpha1.StatusReady
+	var messages []string
+	if len(notReady) > 0 {
+		condition.Reason = "NamespacesNotReady"
+		messages = append(messages, "Not ready namespaces: "+strings.Join(notReady, ", "))
+	}
+	if len(notReadyNodeGroups) > 0 {
+		if condition.Reason == "AllNamespacesReady" {
+			condition.Reason = "NodesNotReady"
+		}
+		messages = append(messages, "Not ready node groups: "+strings.Join(notReadyNodeGroups, ", "))
+	}
+	if len(messages) > 0 {
+		status.Status = commonv1alpha1.StatusNotReady
+		condition.Status = metav1.ConditionFalse
+		condition.Message = strings.Join(messages, "; ")
+	}
+	commonv1alpha1.SetCondition(&status.Conditions, condition)
+
+	if equality.Semantic.DeepEqual(original.Status, clusterHealth.Status) {
+		return ctrl.Result{}, nil
+	}
+	log.Info("Status", "status", status.Status, "namespaces", len(summaries))
+
+	err = r.Status().Patch(ctx, clusterHealth, client.MergeFrom(original))
+	if err != nil {
+		log.Error(err, "Failed to update ClusterHealth status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// selectedNamespaces returns the set of namespaces matching the selector of
+// clusterHealth or nil when all namespaces are selected.
+func (r *ClusterHealthReconciler) selectedNamespaces(ctx context.Context, clusterHealth *commonv1alpha1.ClusterHealth) (map[string]bool, error) {
+	if clusterHealth.Spec.NamespaceSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(clusterHealth.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := &corev1.NamespaceList{}
+	err = r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	selected := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		selected[ns.Name] = true
+	}
+	return selected, nil
+}
+
+// allClusterHealths maps any event to reconcile requests for every ClusterHealth
+func (r *ClusterHealthReconciler) allClusterHealths(handler.MapObject) []reconcile.Request {
+	list := &commonv1alpha1.ClusterHealthList{}
+	err := r.List(context.Background(), list)
+	if err != nil {
+		r.Log.Error(err, "Failed to list ClusterHealth")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: item.Name}})
+	}
+	return requests
+}
+
+func (r *ClusterHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	enqueueAll := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.allClusterHealths)}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&commonv1alpha1.ClusterHealth{}).
+		Watches(&source.Kind{Type: &commonv1alpha1.Health{}}, enqueueAll).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, enqueueAll).
+		Watches(&source.Kind{Type: &corev1.Node{}}, enqueueAll,
+			builder.WithPredicates(predicate.Funcs{UpdateFunc: nodeStateChanged})).
+		Complete(r)
+}
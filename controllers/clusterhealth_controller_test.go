@@ -0,0 +1,162 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestSummarizeHealth(t *testing.T) {
+	health := &commonv1alpha1.Health{}
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Status: commonv1alpha1.StatusReady},
+			"scheduler": {Status: commonv1alpha1.StatusNotReady},
+			"conductor": {Status: commonv1alpha1.StatusNotReady, SilencedBy: "upgrade"},
+		},
+		"glance": {
+			"api": {Status: commonv1alpha1.StatusReady, Endpoints: map[string]commonv1alpha1.EndpointStatus{"glance-api": {Ready: 0, Minimum: 1}}},
+		},
+	}
+	summary := summarizeHealth(health)
+	want := commonv1alpha1.NamespaceSummary{
+		Status:             commonv1alpha1.StatusDegraded,
+		Ready:              2,
+		NotReady:           2,
+		NotReadyComponents: []string{"glance/api", "nova/scheduler"},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary %+v, want %+v", summary, want)
+	}
+}
+
+func TestClusterHealthReconcile(t *testing.T) {
+	health := func(namespace, name string, status string) *commonv1alpha1.Health {
+		health := &commonv1alpha1.Health{}
+		health.Name, health.Namespace = name, namespace
+		health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+			"app": {"component": {Status: status}},
+		}
+		return health
+	}
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		ns := &corev1.Namespace{}
+		ns.Name, ns.Labels = name, labels
+		return ns
+	}
+	openstack := map[string]string{"tier": "openstack"}
+	objects := []runtime.Object{
+		namespace("openstack", openstack),
+		namespace("ceph", openstack),
+		namespace("monitoring", nil),
+		health("openstack", "health", commonv1alpha1.StatusReady),
+		health("ceph", "health", commonv1alpha1.StatusNotReady),
+		health("monitoring", "health", commonv1alpha1.StatusNotReady),
+		// only the Health named health of a namespace is aggregated
+		health("openstack", "other", commonv1alpha1.StatusNotReady),
+		testNode("cmp-1", nil),
+	}
+
+	tests := []struct {
+		name       string
+		spec       commonv1alpha1.ClusterHealthSpec
+		namespaces map[string]string
+		nodes      bool
+		status     string
+		reason     string
+	}{
+		{
+			name:       "all namespaces",
+			namespaces: map[string]string{"openstack": "ready", "ceph": "degraded", "monitoring": "degraded"},
+			status:     commonv1alpha1.StatusNotReady,
+			reason:     "NamespacesNotReady",
+		},
+		{
+			name:       "selected namespaces",
+			spec:       commonv1alpha1.ClusterHealthSpec{NamespaceSelector: &metav1.LabelSelector{MatchLabels: openstack}},
+			namespaces: map[string]string{"openstack": "ready", "ceph": "degraded"},
+			status:     commonv1alpha1.StatusNotReady,
+			reason:     "NamespacesNotReady",
+		},
+		{
+			name: "set based selector and nodes",
+			spec: commonv1alpha1.ClusterHealthSpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpDoesNotExist},
+				}},
+				Nodes: &commonv1alpha1.NodeSummarySpec{},
+			},
+			namespaces: map[string]string{"monitoring": "degraded"},
+			nodes:      true,
+			status:     commonv1alpha1.StatusNotReady,
+			reason:     "NamespacesNotReady",
+		},
+		{
+			name:       "no namespace selected",
+			spec:       commonv1alpha1.ClusterHealthSpec{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "none"}}},
+			namespaces: map[string]string{},
+			status:     commonv1alpha1.StatusReady,
+			reason:     "AllNamespacesReady",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterHealth := &commonv1alpha1.ClusterHealth{}
+			clusterHealth.Name = "cluster"
+			clusterHealth.Spec = test.spec
+			c := fake.NewFakeClientWithScheme(testScheme(t), append(objects, clusterHealth)...)
+			r := &ClusterHealthReconciler{Client: c, Log: ctrl.Log}
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: clusterHealth.Name}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.Get(context.Background(), types.NamespacedName{Name: clusterHealth.Name}, clusterHealth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := clusterHealth.Status
+			namespaces := map[string]string{}
+			for namespace, summary := range status.Namespaces {
+				namespaces[namespace] = summary.Status
+			}
+			if !reflect.DeepEqual(namespaces, test.namespaces) {
+				t.Errorf("namespaces %v, want %v", namespaces, test.namespaces)
+			}
+			if summary := status.Namespaces["openstack"]; summary.Status != "" && (summary.Ready != 1 || summary.NotReady != 0) {
+				t.Errorf("openstack summary %+v aggregates another Health", summary)
+			}
+			if (status.Nodes["all"].Ready == 1) != test.nodes {
+				t.Errorf("nodes %+v, summarized %v", status.Nodes, test.nodes)
+			}
+			condition := commonv1alpha1.FindCondition(status.Conditions, "Ready")
+			if status.Status != test.status || condition == nil || condition.Reason != test.reason {
+				t.Errorf("status %s with condition %+v, want %s with reason %s", status.Status, condition, test.status, test.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	// MaxStalenessAnnotation on a CronJob is the longest allowed time since
+	// the last successful run, e.g. "26h"
+	MaxStalenessAnnotation = "common.amadev.ru/max-staleness"
+
+	// cronJobScheduleGrace is how late a Job may be created before the
+	// schedule is considered missed, unless startingDeadlineSeconds is longer
+	cronJobScheduleGrace = 2 * time.Minute
+)
+
+type CronJobHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// cronJobState is the evaluated health of a CronJob
+type cronJobState struct {
+	status  string
+	reason  string
+	message string
+	// recheck is when the state may change without any object changing
+	recheck time.Time
+}
+
+// calculateStatus evaluates the schedule of obj and the Jobs it created
+func (r *CronJobHealthReconciler) calculateStatus(obj *batchv1beta1.CronJob, jobs []batchv1.Job, now time.Time) cronJobState {
+	if obj.Spec.Suspend != nil && *obj.Spec.Suspend {
+		return cronJobState{status: commonv1alpha1.StatusReady, reason: "Suspended"}
+	}
+
+	schedule, err := cron.ParseStandard(obj.Spec.Schedule)
+	if err != nil {
+		return cronJobState{status: commonv1alpha1.StatusNotReady, reason: "InvalidSchedule", message: err.Error()}
+	}
+
+	state := cronJobState{status: commonv1alpha1.StatusReady, reason: "Scheduled"}
+
+	grace := cronJobScheduleGrace
+	if obj.Spec.StartingDeadlineSeconds != nil {
+		if deadline := time.Duration(*obj.Spec.StartingDeadlineSeconds) * time.Second; deadline > grace {
+			grace = deadline
+		}
+	}
+	lastSchedule := obj.CreationTimestamp.Time
+	if obj.Status.LastScheduleTime != nil {
+		lastSchedule = obj.Status.LastScheduleTime.Time
+	}
+	next := schedule.Next(lastSchedule)
+	if next.Add(grace).Before(now) {
+		return cronJobState{
+			status:  commonv1alpha1.StatusNotReady,
+			reason:  "MissedSchedule",
+			message: fmt.Sprintf("run scheduled at %s was not started", next.UTC().Format(time.RFC3339)),
+		}
+	}
+	state.recheck = next.Add(grace)
+
+	// the most recently finished Job decides whether the last run succeeded
+	var lastFinished *batchv1.Job
+	var lastFinishedAt, lastSuccess time.Time
+	for i := range jobs {
+		job := &jobs[i]
+		finished, succeeded := jobFinished(job)
+		if finished.IsZero() {
+			continue
+		}
+		if finished.After(lastFinishedAt) {
+			lastFinished, lastFinishedAt = job, finished
+		}
+		if succeeded && finished.After(lastSuccess) {
+			lastSuccess = finished
+		}
+	}
+	if lastFinished != nil {
+		if _, succeeded := jobFinished(lastFinished); !succeeded {
+			return cronJobState{
+				status:  commonv1alpha1.StatusNotReady,
+				reason:  "LastRunFailed",
+				message: fmt.Sprintf("job %s failed", lastFinished.Name),
+				recheck: state.recheck,
+			}
+		}
+		state.reason = "LastRunSucceeded"
+	}
+
+	if value, ok := obj.Annotations[MaxStalenessAnnotation]; ok {
+		maxStaleness, err := time.ParseDuration(value)
+		if err != nil {
+			return cronJobState{
+				status:  commonv1alpha1.StatusNotReady,
+				reason:  "InvalidMaxStaleness",
+				message: err.Error(),
+			}
+		}
+		since := lastSuccess
+		if since.IsZero() {
+			since = obj.CreationTimestamp.Time
+		}
+		deadline := since.Add(maxStaleness)
+		if deadline.Before(now) {
+			return cronJobState{
+				status:  commonv1alpha1.StatusNotReady,
+				reason:  "Stale",
+				message: fmt.Sprintf("no successful run for %s, allowed %s", now.Sub(since).Round(time.Second), maxStaleness),
+				recheck: state.recheck,
+			}
+		}
+		if deadline.Before(state.recheck) {
+			state.recheck = deadline
+		}
+	}
+	return state
+}
+
+// jobFinished returns when job finished, zero time if it is still running
+func jobFinished(job *batchv1.Job) (finished time.Time, succeeded bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return c.LastTransitionTime.Time, true
+		case batchv1.JobFailed:
+			return c.LastTransitionTime.Time, false
+		}
+	}
+	return time.Time{}, false
+}
+
+// ownedJobs lists the Jobs created by obj
+func (r *CronJobHealthReconciler) ownedJobs(ctx context.Context, obj *batchv1beta1.CronJob) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(obj.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	var owned []batchv1.Job
+	for _, job := range jobs.Items {
+		if ref := metav1.GetControllerOf(&job); ref != nil && ref.UID == obj.UID {
+			owned = append(owned, job)
+		}
+	}
+	return owned, nil
+}
+
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch
+
+func (r *CronJobHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("cronjobhealth", req.NamespacedName)
+	found := &batchv1beta1.CronJob{}
+	log.Info("Got reconcile request")
+
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Health resource not found. Until health object is present in the namespace, summary will not be created")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Health")
+		return ctrl.Result{}, err
+	}
+
+	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted, removing its component")
+			err = removeComponentsOf(ctx, r.Client, health, componentSource("CronJob", req.Name), nil)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
+		}
+
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	app, component := getIdentity(found.ObjectMeta)
+	log.Info("Identification", "app", app, "component", component)
+
+	jobs, err := r.ownedJobs(ctx, found)
+	if err != nil {
+		log.Error(err, "Failed to list Jobs")
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	state := r.calculateStatus(found, jobs, now)
+	status := commonv1alpha1.ComponentStatus{
+		Status:     state.status,
+		Generation: found.Generation,
+		Reason:     state.reason,
+		Message:    state.message,
+	}
+
+	log.Info("Status", "status", status.Status, "reason", status.Reason)
+
+	status, wait := applyHysteresis(health, app, component, status, now)
+	status.Source = componentSource("CronJob", found.Name)
+	patch, err := getPatch(health, app, component, status)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
+
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+	// a changed identity leaves the component reported before behind
+	err = removeComponentsOf(ctx, r.Client, health, status.Source, map[string]bool{app + "/" + component: true})
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	if state.recheck.IsZero() || state.recheck.Sub(now) > requeueAfter(wait) {
+		return ctrl.Result{RequeueAfter: requeueAfter(wait)}, nil
+	}
+	return ctrl.Result{RequeueAfter: state.recheck.Sub(now)}, nil
+}
+
+func (r *CronJobHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&batchv1beta1.CronJob{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,182 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestCronJobCalculateStatus(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 30, 0, 0, time.UTC)
+	hourly := "0 * * * *"
+	job := func(name string, ago time.Duration, condition batchv1.JobConditionType) batchv1.Job {
+		job := batchv1.Job{}
+		job.Name = name
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               condition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(now.Add(-ago)),
+		}}
+		return job
+	}
+	tests := []struct {
+		name         string
+		schedule     string
+		lastSchedule time.Duration
+		suspend      bool
+		deadline     int64
+		maxStaleness string
+		jobs         []batchv1.Job
+		status       string
+		reason       string
+		recheck      time.Duration
+	}{
+		{
+			name:         "scheduled",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			status:       commonv1alpha1.StatusReady,
+			reason:       "Scheduled",
+			recheck:      32 * time.Minute,
+		},
+		{
+			name:         "missed schedule",
+			schedule:     hourly,
+			lastSchedule: 90 * time.Minute,
+			status:       commonv1alpha1.StatusNotReady,
+			reason:       "MissedSchedule",
+		},
+		{
+			name:         "late within the grace",
+			schedule:     "29 * * * *",
+			lastSchedule: 61 * time.Minute,
+			status:       commonv1alpha1.StatusReady,
+			reason:       "Scheduled",
+			recheck:      time.Minute,
+		},
+		{
+			name:         "late within the starting deadline",
+			schedule:     hourly,
+			lastSchedule: 90 * time.Minute,
+			deadline:     3600,
+			status:       commonv1alpha1.StatusReady,
+			reason:       "Scheduled",
+			recheck:      30 * time.Minute,
+		},
+		{
+			name:         "suspended",
+			schedule:     hourly,
+			lastSchedule: 5 * time.Hour,
+			suspend:      true,
+			status:       commonv1alpha1.StatusReady,
+			reason:       "Suspended",
+		},
+		{
+			name:     "invalid schedule",
+			schedule: "every hour",
+			status:   commonv1alpha1.StatusNotReady,
+			reason:   "InvalidSchedule",
+		},
+		{
+			name:         "last run failed",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			jobs:         []batchv1.Job{job("a", 90*time.Minute, batchv1.JobComplete), job("b", 25*time.Minute, batchv1.JobFailed)},
+			status:       commonv1alpha1.StatusNotReady,
+			reason:       "LastRunFailed",
+			recheck:      32 * time.Minute,
+		},
+		{
+			name:         "last run succeeded",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			jobs:         []batchv1.Job{job("a", 90*time.Minute, batchv1.JobFailed), job("b", 25*time.Minute, batchv1.JobComplete)},
+			status:       commonv1alpha1.StatusReady,
+			reason:       "LastRunSucceeded",
+			recheck:      32 * time.Minute,
+		},
+		{
+			name:         "failure is reported before staleness",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			maxStaleness: "1h",
+			jobs:         []batchv1.Job{job("a", 90*time.Minute, batchv1.JobComplete), job("b", 25*time.Minute, batchv1.JobFailed)},
+			status:       commonv1alpha1.StatusNotReady,
+			reason:       "LastRunFailed",
+			recheck:      32 * time.Minute,
+		},
+		{
+			name:         "no success within the max staleness",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			maxStaleness: "1h",
+			jobs:         []batchv1.Job{job("a", 90*time.Minute, batchv1.JobComplete)},
+			status:       commonv1alpha1.StatusNotReady,
+			reason:       "Stale",
+			recheck:      32 * time.Minute,
+		},
+		{
+			name:         "max staleness ends before the next run",
+			schedule:     hourly,
+			lastSchedule: 30 * time.Minute,
+			maxStaleness: "1h",
+			jobs:         []batchv1.Job{job("a", 50*time.Minute, batchv1.JobComplete)},
+			status:       commonv1alpha1.StatusReady,
+			reason:       "LastRunSucceeded",
+			recheck:      10 * time.Minute,
+		},
+	}
+	r := &CronJobHealthReconciler{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			obj := &batchv1beta1.CronJob{}
+			obj.CreationTimestamp = metav1.NewTime(now.Add(-24 * time.Hour))
+			obj.Spec.Schedule = test.schedule
+			obj.Spec.Suspend = &test.suspend
+			if test.deadline != 0 {
+				obj.Spec.StartingDeadlineSeconds = &test.deadline
+			}
+			if test.lastSchedule != 0 {
+				obj.Status.LastScheduleTime = &metav1.Time{Time: now.Add(-test.lastSchedule)}
+			}
+			if test.maxStaleness != "" {
+				obj.Annotations = map[string]string{MaxStalenessAnnotation: test.maxStaleness}
+			}
+
+			state := r.calculateStatus(obj, test.jobs, now)
+			if state.status != test.status || state.reason != test.reason {
+				t.Errorf("status %s reason %s (%s), want %s reason %s",
+					state.status, state.reason, state.message, test.status, test.reason)
+			}
+			var recheck time.Duration
+			if !state.recheck.IsZero() {
+				recheck = state.recheck.Sub(now)
+			}
+			if recheck != test.recheck {
+				t.Errorf("recheck in %s, want %s", recheck, test.recheck)
+			}
+		})
+	}
+}
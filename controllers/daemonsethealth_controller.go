@@ -18,13 +18,22 @@ package controllers
 
 import (
 	"context"
+	"sort"
+	"time"
+
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
 )
@@ -33,8 +42,14 @@ type DaemonSetHealthReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// WatchNodes enables listing nodes to find the ones missing a pod,
+	// otherwise only nodes running a pod which is not ready are listed
+	WatchNodes bool
 }
 
+// maxMissingNodes bounds the number of nodes listed for a DaemonSet
+const maxMissingNodes = 10
+
 func (r *DaemonSetHealthReconciler) calculateStatus(obj *appsv1.DaemonSet) string {
 	status := "notready"
 
@@ -48,6 +63,99 @@ func (r *DaemonSetHealthReconciler) calculateStatus(obj *appsv1.DaemonSet) strin
 	return status
 }
 
+// countNodes fills the counters of obj and lists the nodes which should
+// run a ready pod but do not. With ignoreUnavailable cordoned and
+// NotReady nodes are not listed and only counted as ignored.
+func (r *DaemonSetHealthReconciler) countNodes(ctx context.Context, obj *appsv1.DaemonSet, ignoreUnavailable bool) (*commonv1alpha1.DaemonSetCounts, error) {
+	counts := &commonv1alpha1.DaemonSetCounts{
+		Desired:      obj.Status.DesiredNumberScheduled,
+		Ready:        obj.Status.NumberReady,
+		Unavailable:  obj.Status.NumberUnavailable,
+		Misscheduled: obj.Status.NumberMisscheduled,
+	}
+
+	pods, err := ownedPods(ctx, r.Client, obj.Namespace, obj.Spec.Selector, map[types.UID]bool{obj.UID: true})
+	if err != nil {
+		return counts, err
+	}
+	ready := map[string]bool{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName != "" && !ready[pod.Spec.NodeName] {
+			ready[pod.Spec.NodeName] = podReady(pod)
+		}
+	}
+
+	var missing []string
+	if r.WatchNodes {
+		nodes := &corev1.NodeList{}
+		err = r.List(ctx, nodes)
+		if err != nil {
+			return counts, err
+		}
+		for i := range nodes.Items {
+			node := &nodes.Items[i]
+			if ready[node.Name] || !nodeRunsPod(node, &obj.Spec.Template.Spec) {
+				continue
+			}
+			if ignoreUnavailable && nodeUnavailable(node) {
+				counts.IgnoredNodes++
+				continue
+			}
+			missing = append(missing, node.Name)
+		}
+	} else {
+		for node, isReady := range ready {
+			if !isReady {
+				missing = append(missing, node)
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > maxMissingNodes {
+		missing = missing[:maxMissingNodes]
+	}
+	counts.MissingNodes = missing
+	return counts, nil
+}
+
+// podReady reports whether the Ready condition of pod is true
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// diagnose summarizes the pods controlled by obj
+func (r *DaemonSetHealthReconciler) diagnose(ctx context.Context, obj *appsv1.DaemonSet) ([]commonv1alpha1.PodDiagnostic, error) {
+	pods, err := ownedPods(ctx, r.Client, obj.Namespace, obj.Spec.Selector, map[types.UID]bool{obj.UID: true})
+	if err != nil {
+		return nil, err
+	}
+	return diagnosePods(pods), nil
+}
+
+// nodeToDaemonSets maps a node to all DaemonSets, any of them may be
+// expected to run on it
+func (r *DaemonSetHealthReconciler) nodeToDaemonSets(obj handler.MapObject) []reconcile.Request {
+	daemonSets := &appsv1.DaemonSetList{}
+	err := r.List(context.Background(), daemonSets)
+	if err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(daemonSets.Items))
+	for _, daemonSet := range daemonSets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: daemonSet.Name, Namespace: daemonSet.Namespace}})
+	}
+	return requests
+}
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch
+
 func (r *DaemonSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("daemonsethealth", req.NamespacedName)
@@ -68,8 +176,12 @@ func (r *DaemonSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			log.Info("Object was deleted. Finalazer is not used. Skipping that case")
-			return ctrl.Result{}, nil
+			log.Info("Object was deleted, removing its component")
+			err = removeComponentsOf(ctx, r.Client, health, componentSource("DaemonSet", req.Name), nil)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
 		}
 
 		log.Error(err, "Failed to get an object")
@@ -79,27 +191,78 @@ func (r *DaemonSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 	app, component := getIdentity(found.ObjectMeta)
 	log.Info("Identification", "app", app, "component", component)
 
-	status := r.calculateStatus(found)
-
-	log.Info("Status", "status", status)
+	status := commonv1alpha1.ComponentStatus{
+		Status:     r.calculateStatus(found),
+		Generation: found.Generation,
+	}
+	ignoreUnavailable := health.Spec.IgnoreUnavailableNodes && r.WatchNodes
+	status.DaemonSet, err = r.countNodes(ctx, found, ignoreUnavailable)
+	if err != nil {
+		log.Error(err, "Failed to find nodes missing a pod")
+	}
+	switch {
+	case found.Status.DesiredNumberScheduled == 0:
+		status.Status = commonv1alpha1.StatusNotReady
+		status.Reason = "NoNodes"
+		status.Message = "no node matches the node selector, affinity and tolerations"
+	case status.Status != commonv1alpha1.StatusReady && ignoreUnavailable && err == nil &&
+		len(status.DaemonSet.MissingNodes) == 0 && status.DaemonSet.IgnoredNodes > 0 &&
+		found.Status.ObservedGeneration >= found.Generation:
+		status.Status = commonv1alpha1.StatusReady
+		status.Reason = "UnavailableNodesIgnored"
+	}
+	if status.Status != commonv1alpha1.StatusReady {
+		status.Diagnostics, err = r.diagnose(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to diagnose pods")
+		}
+	}
 
-	patch := getPatch(app, component, status, found.Generation)
+	log.Info("Status", "status", status.Status, "reason", status.Reason)
 
-	err = r.Status().Patch(
-		ctx,
-		health,
-		client.RawPatch(types.MergePatchType, patch))
+	now := time.Now()
+	status, wait := applyHysteresis(health, app, component, status, now)
+	status.Source = componentSource("DaemonSet", found.Name)
+	// the rollout is recorded as observed, regardless of the hysteresis
+	revision, err := daemonSetRevision(ctx, r.Client, found)
+	if err != nil {
+		log.Error(err, "Failed to find the newest controller revision")
+	}
+	status.Rollout = trackRollout(health, app, component, commonv1alpha1.Rollout{
+		Generation: found.Generation,
+		Revision:   revision,
+		Images:     templateImages(&found.Spec.Template),
+	}, daemonSetRolledOut(found), now)
+	patch, err := getPatch(health, app, component, status)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
 
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+	// a changed identity leaves the component reported before behind
+	err = removeComponentsOf(ctx, r.Client, health, status.Source, map[string]bool{app + "/" + component: true})
 	if err != nil {
 		log.Error(err, "Failed to update Health status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter(wait)}, nil
 }
 
 func (r *DaemonSetHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.DaemonSet{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &corev1.Pod{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &appsv1.DaemonSet{}, IsController: true})
+	if r.WatchNodes {
+		builder = builder.Watches(&source.Kind{Type: &corev1.Node{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.nodeToDaemonSets)},
+			ctrlbuilder.WithPredicates(predicate.Funcs{UpdateFunc: nodeStateChanged}))
+	}
+	return builder.Complete(r)
 }
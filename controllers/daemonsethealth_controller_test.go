@@ -0,0 +1,92 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCountNodes(t *testing.T) {
+	obj := &appsv1.DaemonSet{}
+	obj.Name, obj.Namespace, obj.UID = "nova-compute", "openstack", "daemonset"
+	obj.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"application": "nova"}}
+	obj.Spec.Template.Spec.NodeSelector = map[string]string{"openstack-compute-node": "enabled"}
+	obj.Status.DesiredNumberScheduled = 4
+	obj.Status.NumberReady = 1
+	obj.Status.NumberUnavailable = 3
+
+	controller := true
+	pod := func(node string, ready corev1.ConditionStatus) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name, pod.Namespace = "nova-compute-"+node, obj.Namespace
+		pod.Labels = obj.Spec.Selector.MatchLabels
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: obj.Name, UID: obj.UID, Controller: &controller}}
+		pod.Spec.NodeName = node
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}
+		return pod
+	}
+	compute := map[string]string{"openstack-compute-node": "enabled"}
+	cordoned := testNode("cmp-4", compute)
+	cordoned.Spec.Unschedulable = true
+	notReady := testNode("cmp-5", compute)
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	objects := []runtime.Object{
+		testNode("cmp-1", compute),
+		testNode("cmp-2", compute),
+		testNode("cmp-3", compute),
+		cordoned,
+		notReady,
+		testNode("ctl-1", nil),
+		pod("cmp-1", corev1.ConditionTrue),
+		pod("cmp-2", corev1.ConditionFalse),
+	}
+
+	tests := []struct {
+		name              string
+		watchNodes        bool
+		ignoreUnavailable bool
+		missing           []string
+		ignored           int32
+	}{
+		{name: "pods only", missing: []string{"cmp-2"}},
+		{name: "nodes", watchNodes: true, missing: []string{"cmp-2", "cmp-3", "cmp-4", "cmp-5"}},
+		{name: "unavailable nodes ignored", watchNodes: true, ignoreUnavailable: true, missing: []string{"cmp-2", "cmp-3"}, ignored: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &DaemonSetHealthReconciler{Client: fake.NewFakeClientWithScheme(testScheme(t), objects...), WatchNodes: test.watchNodes}
+			counts, err := r.countNodes(context.Background(), obj, test.ignoreUnavailable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts.Desired != 4 || counts.Ready != 1 || counts.Unavailable != 3 {
+				t.Errorf("counters %+v not copied from the DaemonSet status", counts)
+			}
+			if !reflect.DeepEqual(counts.MissingNodes, test.missing) || counts.IgnoredNodes != test.ignored {
+				t.Errorf("missing %v and %d ignored, want %v and %d ignored", counts.MissingNodes, counts.IgnoredNodes, test.missing, test.ignored)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// dependencyGraph maps components as app/component to the components they
+// depend on. References to an application are expanded to all its
+// components, references to unknown applications or components are kept
+// as they are and never healthy. Self-references are ignored, also those of
+// an application, whose components would otherwise form a cycle.
+func dependencyGraph(health *commonv1alpha1.Health) map[string][]string {
+	expand := func(ref string) []string {
+		if strings.Contains(ref, "/") {
+			return []string{ref}
+		}
+		components, ok := health.Status.Applications[ref]
+		if !ok || len(components) == 0 {
+			return []string{ref}
+		}
+		keys := make([]string, 0, len(components))
+		for component := range components {
+			keys = append(keys, ref+"/"+component)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	edges := map[string][]string{}
+	for _, dependency := range health.Spec.Dependencies {
+		for _, dependent := range expand(dependency.Component) {
+			for _, ref := range dependency.DependsOn {
+				if ref == dependency.Component {
+					continue
+				}
+				for _, required := range expand(ref) {
+					if required != dependent {
+						edges[dependent] = append(edges[dependent], required)
+					}
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// findCycle returns the components of a dependency cycle, starting and
+// ending with the same component, or nil when there is none
+func findCycle(edges map[string][]string) []string {
+	nodes := make([]string, 0, len(edges))
+	for node := range edges {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = inProgress
+		path = append(path, node)
+		for _, next := range edges[node] {
+			switch state[next] {
+			case inProgress:
+				for i := range path {
+					if path[i] == next {
+						return append(append([]string{}, path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = done
+		return nil
+	}
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// impactedBy returns the unhealthy components component depends on, directly
+// or through healthy components, at most maxListedComponents of them
+func impactedBy(edges map[string][]string, component string, healthy map[string]bool) []string {
+	visited := map[string]bool{component: true}
+	var unhealthy []string
+	queue := append([]string{}, edges[component]...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if visited[next] {
+			continue
+		}
+		visited[next] = true
+		if !healthy[next] {
+			unhealthy = append(unhealthy, next)
+			continue
+		}
+		queue = append(queue, edges[next]...)
+	}
+	sort.Strings(unhealthy)
+	if len(unhealthy) > maxListedComponents {
+		unhealthy = unhealthy[:maxListedComponents]
+	}
+	return unhealthy
+}
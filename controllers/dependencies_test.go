@@ -0,0 +1,170 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	ready := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady}
+	applications := map[string]commonv1alpha1.ApplicationStatus{
+		"nova":     {"api": ready, "scheduler": ready},
+		"keystone": {"api": ready},
+	}
+	tests := []struct {
+		name         string
+		dependencies []commonv1alpha1.Dependency
+		edges        map[string][]string
+		cycle        []string
+	}{
+		{
+			name:         "component",
+			dependencies: []commonv1alpha1.Dependency{{Component: "nova/api", DependsOn: []string{"keystone/api"}}},
+			edges:        map[string][]string{"nova/api": {"keystone/api"}},
+		},
+		{
+			name:         "application references are expanded",
+			dependencies: []commonv1alpha1.Dependency{{Component: "nova", DependsOn: []string{"keystone", "mariadb"}}},
+			edges: map[string][]string{
+				"nova/api":       {"keystone/api", "mariadb"},
+				"nova/scheduler": {"keystone/api", "mariadb"},
+			},
+		},
+		{
+			name: "direct cycle",
+			dependencies: []commonv1alpha1.Dependency{
+				{Component: "nova/api", DependsOn: []string{"keystone/api"}},
+				{Component: "keystone/api", DependsOn: []string{"nova/api"}},
+			},
+			edges: map[string][]string{"nova/api": {"keystone/api"}, "keystone/api": {"nova/api"}},
+			cycle: []string{"keystone/api", "nova/api", "keystone/api"},
+		},
+		{
+			name: "cycle through applications without components",
+			dependencies: []commonv1alpha1.Dependency{
+				{Component: "glance", DependsOn: []string{"ceph"}},
+				{Component: "ceph", DependsOn: []string{"glance"}},
+			},
+			edges: map[string][]string{"glance": {"ceph"}, "ceph": {"glance"}},
+			cycle: []string{"ceph", "glance", "ceph"},
+		},
+		{
+			name:         "component self-reference",
+			dependencies: []commonv1alpha1.Dependency{{Component: "nova/api", DependsOn: []string{"nova/api"}}},
+			edges:        map[string][]string{},
+		},
+		{
+			name:         "application self-reference",
+			dependencies: []commonv1alpha1.Dependency{{Component: "nova", DependsOn: []string{"nova"}}},
+			edges:        map[string][]string{},
+		},
+		{
+			name:         "component on its own application",
+			dependencies: []commonv1alpha1.Dependency{{Component: "nova/api", DependsOn: []string{"nova"}}},
+			edges:        map[string][]string{"nova/api": {"nova/scheduler"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Spec.Dependencies = test.dependencies
+			health.Status.Applications = applications
+			edges := dependencyGraph(health)
+			if !reflect.DeepEqual(edges, test.edges) {
+				t.Errorf("edges %v, want %v", edges, test.edges)
+			}
+			if cycle := findCycle(edges); !reflect.DeepEqual(cycle, test.cycle) {
+				t.Errorf("cycle %v, want %v", cycle, test.cycle)
+			}
+		})
+	}
+}
+
+func TestImpactedBy(t *testing.T) {
+	edges := map[string][]string{
+		"nova/api":        {"keystone/api", "nova/conductor"},
+		"keystone/api":    {"mariadb/server"},
+		"nova/conductor":  {"rabbitmq/server"},
+		"glance/api":      {"glance/registry"},
+		"glance/registry": {"glance/api"},
+	}
+	tests := []struct {
+		name      string
+		component string
+		unhealthy []string
+		impacted  []string
+	}{
+		{
+			name:      "all healthy",
+			component: "nova/api",
+		},
+		{
+			name:      "direct dependency",
+			component: "nova/api",
+			unhealthy: []string{"keystone/api"},
+			impacted:  []string{"keystone/api"},
+		},
+		{
+			name:      "transitive through healthy components",
+			component: "nova/api",
+			unhealthy: []string{"mariadb/server", "rabbitmq/server"},
+			impacted:  []string{"mariadb/server", "rabbitmq/server"},
+		},
+		{
+			name:      "stops at the first unhealthy component",
+			component: "nova/api",
+			unhealthy: []string{"keystone/api", "mariadb/server"},
+			impacted:  []string{"keystone/api"},
+		},
+		{
+			name:      "unrelated failure",
+			component: "keystone/api",
+			unhealthy: []string{"rabbitmq/server"},
+		},
+		{
+			name:      "cycle terminates",
+			component: "glance/api",
+		},
+		{
+			name:      "component itself in a cycle",
+			component: "glance/api",
+			unhealthy: []string{"glance/api"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			healthy := map[string]bool{}
+			for node, requires := range edges {
+				healthy[node] = true
+				for _, required := range requires {
+					healthy[required] = true
+				}
+			}
+			for _, component := range test.unhealthy {
+				healthy[component] = false
+			}
+			impacted := impactedBy(edges, test.component, healthy)
+			if !reflect.DeepEqual(impacted, test.impacted) {
+				t.Errorf("impacted by %v, want %v", impacted, test.impacted)
+			}
+		})
+	}
+}
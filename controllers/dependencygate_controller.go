@@ -0,0 +1,137 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// DependencyGateReconciler restores the replicas of the Deployments and
+// StatefulSets held by the DependencyGate once their dependencies are ready
+// in the Health of the namespace. Without a Health all of them are
+// released, like the DependencyGate does not gate then.
+type DependencyGateReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// Patching Deployments and StatefulSets is only granted by the gating role
+// of config/webhook, the default role stays read only.
+
+func (r *DependencyGateReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("health", req.NamespacedName)
+	found := &commonv1alpha1.Health{}
+	log.Info("Got reconcile request")
+
+	err := r.Get(ctx, req.NamespacedName, found)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Error(err, "Failed to get an object")
+			return ctrl.Result{}, err
+		}
+		log.Info("Health was deleted, releasing all gated workloads")
+		found = nil
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	err = r.List(ctx, deployments, client.InNamespace(req.Namespace))
+	if err != nil {
+		log.Error(err, "Failed to list Deployments")
+		return ctrl.Result{}, err
+	}
+	for i := range deployments.Items {
+		obj := &deployments.Items[i]
+		original := obj.DeepCopy()
+		if !r.release(found, &obj.ObjectMeta, &obj.Spec.Replicas) {
+			continue
+		}
+		log.Info("Releasing Deployment", "deployment", obj.Name)
+		err = r.Patch(ctx, obj, client.MergeFrom(original))
+		if err != nil {
+			log.Error(err, "Failed to release Deployment", "deployment", obj.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	err = r.List(ctx, statefulSets, client.InNamespace(req.Namespace))
+	if err != nil {
+		log.Error(err, "Failed to list StatefulSets")
+		return ctrl.Result{}, err
+	}
+	for i := range statefulSets.Items {
+		obj := &statefulSets.Items[i]
+		original := obj.DeepCopy()
+		if !r.release(found, &obj.ObjectMeta, &obj.Spec.Replicas) {
+			continue
+		}
+		log.Info("Releasing StatefulSet", "statefulset", obj.Name)
+		err = r.Patch(ctx, obj, client.MergeFrom(original))
+		if err != nil {
+			log.Error(err, "Failed to release StatefulSet", "statefulset", obj.Name)
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// release restores the replicas of a gated workload when health, if any,
+// reports its dependencies ready and reports whether it did
+func (r *DependencyGateReconciler) release(health *commonv1alpha1.Health, meta *metav1.ObjectMeta, replicas **int32) bool {
+	if _, ok := meta.Annotations[GatedReplicasAnnotation]; !ok {
+		return false
+	}
+	var pending []string
+	if health != nil {
+		pending = pendingDependencies(health, requiredDependencies(meta.Annotations[DependsOnAnnotation]))
+	}
+	return len(pending) == 0 && gateReplicas(meta, replicas, nil, false)
+}
+
+// gated reports whether a workload is held by the DependencyGate
+func gated(meta metav1.Object, _ runtime.Object) bool {
+	_, ok := meta.GetAnnotations()[GatedReplicasAnnotation]
+	return ok
+}
+
+func (r *DependencyGateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	toHealth := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(namespaceHealth)}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("dependencygate").
+		For(&commonv1alpha1.Health{}).
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, toHealth,
+			ctrlbuilder.WithPredicates(predicate.NewPredicateFuncs(gated))).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, toHealth,
+			ctrlbuilder.WithPredicates(predicate.NewPredicateFuncs(gated))).
+		Complete(r)
+}
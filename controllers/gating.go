@@ -0,0 +1,203 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	// GatingLabel opts a Deployment or StatefulSet into dependency gating
+	// with the value "true", the webhook only receives labeled workloads
+	GatingLabel = "common.amadev.ru/dependency-gating"
+	// DependsOnAnnotation lists the applications ("app") and components
+	// ("app/component") of the Health in the namespace a Deployment or
+	// StatefulSet requires, separated by commas
+	DependsOnAnnotation = "common.amadev.ru/depends-on"
+	// GatedReplicasAnnotation keeps the replicas of a workload held at zero
+	// until its dependencies are ready
+	GatedReplicasAnnotation = "common.amadev.ru/gated-replicas"
+)
+
+// requiredDependencies parses the value of DependsOnAnnotation
+func requiredDependencies(value string) []string {
+	var refs []string
+	for _, ref := range strings.Split(value, ",") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// dependencyReady reports whether a component is running and healthy.
+// Scaled down components are never ready, whatever the policy of the
+// spec says, so that a dependency held by the DependencyGate itself does
+// not release its dependents.
+func dependencyReady(health *commonv1alpha1.Health, status commonv1alpha1.ComponentStatus) bool {
+	return status.Status != commonv1alpha1.StatusScaledDown && health.Spec.Healthy(status)
+}
+
+// pendingDependencies returns the components of refs which are not ready
+// in health. References to an application require all its components,
+// unknown applications and components are never ready.
+func pendingDependencies(health *commonv1alpha1.Health, refs []string) []string {
+	var pending []string
+	for _, ref := range refs {
+		app, component := ref, ""
+		if i := strings.Index(ref, "/"); i >= 0 {
+			app, component = ref[:i], ref[i+1:]
+		}
+		components := health.Status.Applications[app]
+		if component != "" {
+			status, ok := components[component]
+			if !ok || !dependencyReady(health, status) {
+				pending = append(pending, ref)
+			}
+			continue
+		}
+		if len(components) == 0 {
+			pending = append(pending, ref)
+		}
+		for name, status := range components {
+			if !dependencyReady(health, status) {
+				pending = append(pending, app+"/"+name)
+			}
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// gateReplicas holds the replicas of a workload at zero while pending lists
+// dependencies and restores them once there are none. New workloads are
+// gated, existing ones only stay gated, so that updates never scale down a
+// running workload. It reports whether meta or replicas changed.
+func gateReplicas(meta *metav1.ObjectMeta, replicas **int32, pending []string, create bool) bool {
+	desired := int32(1)
+	if *replicas != nil {
+		desired = **replicas
+	}
+	gated, isGated := meta.Annotations[GatedReplicasAnnotation]
+	if isGated && desired == 0 {
+		// the update left the held replicas as they are
+		if n, err := strconv.ParseInt(gated, 10, 32); err == nil {
+			desired = int32(n)
+		}
+	}
+
+	switch {
+	case len(pending) == 0 && isGated:
+		delete(meta.Annotations, GatedReplicasAnnotation)
+		*replicas = &desired
+		return true
+	case len(pending) > 0 && (isGated || create) && desired > 0:
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[GatedReplicasAnnotation] = strconv.Itoa(int(desired))
+		zero := int32(0)
+		*replicas = &zero
+		return true
+	}
+	return false
+}
+
+// scaledDownReason explains why a workload is scaled down, either held by
+// the DependencyGate or scaled down on purpose
+func scaledDownReason(meta metav1.ObjectMeta) (reason, message string) {
+	if _, ok := meta.Annotations[GatedReplicasAnnotation]; ok {
+		return "WaitingForDependencies", "replicas are held until dependencies are ready: " + meta.Annotations[DependsOnAnnotation]
+	}
+	return "ScaledDown", ""
+}
+
+// +kubebuilder:webhook:path=/mutate-apps-v1-workload,mutating=true,failurePolicy=ignore,groups=apps,resources=deployments;statefulsets,verbs=create;update,versions=v1,name=gate.common.amadev.ru
+
+// DependencyGate is a mutating admission webhook holding the replicas of
+// new Deployments and StatefulSets labeled with GatingLabel and annotated
+// with DependsOnAnnotation at zero until their dependencies are ready in the Health of the namespace.
+// Workloads are released by the DependencyGateReconciler.
+type DependencyGate struct {
+	client.Client
+	Log logr.Logger
+}
+
+// Handle implements admission.Handler
+func (g *DependencyGate) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := g.Log.WithValues("kind", req.Kind.Kind, "object", types.NamespacedName{Name: req.Name, Namespace: req.Namespace})
+	var obj interface{}
+	var meta *metav1.ObjectMeta
+	var replicas **int32
+	switch req.Kind.Kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		obj, meta, replicas = deployment, &deployment.ObjectMeta, &deployment.Spec.Replicas
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		obj, meta, replicas = statefulSet, &statefulSet.ObjectMeta, &statefulSet.Spec.Replicas
+	default:
+		return admission.Allowed("")
+	}
+	err := json.Unmarshal(req.Object.Raw, obj)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	value, ok := meta.Annotations[DependsOnAnnotation]
+	_, isGated := meta.Annotations[GatedReplicasAnnotation]
+	if !isGated && (meta.Labels[GatingLabel] != "true" || !ok) {
+		return admission.Allowed("")
+	}
+
+	health := &commonv1alpha1.Health{}
+	err = g.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to get Health")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	// without a Health dependencies can not be checked, nothing is gated
+	var pending []string
+	if err == nil {
+		pending = pendingDependencies(health, requiredDependencies(value))
+	}
+	if !gateReplicas(meta, replicas, pending, req.Operation == admissionv1beta1.Create) {
+		return admission.Allowed("")
+	}
+	if len(pending) > 0 {
+		log.Info("Holding replicas until dependencies are ready", "pending", pending)
+	}
+	current, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, current)
+}
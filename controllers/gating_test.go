@@ -0,0 +1,160 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestPendingDependencies(t *testing.T) {
+	health := &commonv1alpha1.Health{}
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"mariadb": {
+			"server": {Status: commonv1alpha1.StatusReady},
+		},
+		"rabbitmq": {
+			"server":  {Status: commonv1alpha1.StatusReady},
+			"cluster": {Status: commonv1alpha1.StatusNotReady},
+		},
+		"memcached": {
+			"server": {Status: commonv1alpha1.StatusScaledDown},
+		},
+	}
+	tests := []struct {
+		name    string
+		refs    []string
+		pending []string
+	}{
+		{name: "ready component", refs: []string{"mariadb/server"}},
+		{name: "ready application", refs: []string{"mariadb"}},
+		{name: "no dependencies"},
+		{name: "application with a failed component", refs: []string{"rabbitmq"}, pending: []string{"rabbitmq/cluster"}},
+		{name: "unknown component", refs: []string{"mariadb/galera"}, pending: []string{"mariadb/galera"}},
+		{name: "unknown application", refs: []string{"keystone"}, pending: []string{"keystone"}},
+		{name: "scaled down component", refs: []string{"memcached/server"}, pending: []string{"memcached/server"}},
+		{
+			name:    "sorted",
+			refs:    []string{"rabbitmq/cluster", "keystone", "mariadb"},
+			pending: []string{"keystone", "rabbitmq/cluster"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pending := pendingDependencies(health, test.refs)
+			if !reflect.DeepEqual(pending, test.pending) {
+				t.Errorf("pending %v, want %v", pending, test.pending)
+			}
+		})
+	}
+}
+
+func TestGateReplicas(t *testing.T) {
+	int32Ptr := func(n int32) *int32 { return &n }
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		replicas    *int32
+		pending     []string
+		create      bool
+		changed     bool
+		want        *int32
+		gated       string
+	}{
+		{
+			name:     "new workload is held",
+			replicas: int32Ptr(3),
+			pending:  []string{"mariadb"},
+			create:   true,
+			changed:  true,
+			want:     int32Ptr(0),
+			gated:    "3",
+		},
+		{
+			name:    "default replicas are held",
+			pending: []string{"mariadb"},
+			create:  true,
+			changed: true,
+			want:    int32Ptr(0),
+			gated:   "1",
+		},
+		{
+			name:     "new workload without pending dependencies",
+			replicas: int32Ptr(3),
+			create:   true,
+			want:     int32Ptr(3),
+		},
+		{
+			name:     "running workload is not scaled down",
+			replicas: int32Ptr(3),
+			pending:  []string{"mariadb"},
+			want:     int32Ptr(3),
+		},
+		{
+			name:        "update keeps held replicas",
+			annotations: map[string]string{GatedReplicasAnnotation: "3"},
+			replicas:    int32Ptr(0),
+			pending:     []string{"mariadb"},
+			changed:     true,
+			want:        int32Ptr(0),
+			gated:       "3",
+		},
+		{
+			name:        "update of held replicas is kept for the release",
+			annotations: map[string]string{GatedReplicasAnnotation: "3"},
+			replicas:    int32Ptr(5),
+			pending:     []string{"mariadb"},
+			changed:     true,
+			want:        int32Ptr(0),
+			gated:       "5",
+		},
+		{
+			name:        "release",
+			annotations: map[string]string{GatedReplicasAnnotation: "3"},
+			replicas:    int32Ptr(0),
+			changed:     true,
+			want:        int32Ptr(3),
+		},
+		{
+			name:     "scaled to zero on purpose",
+			replicas: int32Ptr(0),
+			pending:  []string{"mariadb"},
+			create:   true,
+			want:     int32Ptr(0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := &metav1.ObjectMeta{Annotations: test.annotations}
+			replicas := test.replicas
+			changed := gateReplicas(meta, &replicas, test.pending, test.create)
+			if changed != test.changed {
+				t.Errorf("changed %v, want %v", changed, test.changed)
+			}
+			if !reflect.DeepEqual(replicas, test.want) {
+				t.Errorf("replicas %v, want %v", replicas, test.want)
+			}
+			if meta.Annotations[GatedReplicasAnnotation] != test.gated {
+				t.Errorf("gated replicas %q, want %q", meta.Annotations[GatedReplicasAnnotation], test.gated)
+			}
+		})
+	}
+}
@@ -18,13 +18,20 @@ package controllers
 
 import (
 	"context"
+	"time"
+
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
 )
@@ -55,11 +62,55 @@ func (r *HealthReconciler) calculateStatus(obj *appsv1.Deployment) string {
 
 }
 
-// +kubebuilder:rbac:groups=common.amadev.ru,resources=healths,verbs=get;list;watch;create;update;patch;delete
+// diagnose summarizes the pods of the ReplicaSets controlled by obj
+func (r *HealthReconciler) diagnose(ctx context.Context, obj *appsv1.Deployment) ([]commonv1alpha1.PodDiagnostic, error) {
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	err = r.List(ctx, replicaSets, client.InNamespace(obj.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	owners := map[types.UID]bool{}
+	for i := range replicaSets.Items {
+		if ref := metav1.GetControllerOf(&replicaSets.Items[i]); ref != nil && ref.UID == obj.UID {
+			owners[replicaSets.Items[i].UID] = true
+		}
+	}
+	pods, err := ownedPods(ctx, r.Client, obj.Namespace, obj.Spec.Selector, owners)
+	if err != nil {
+		return nil, err
+	}
+	return diagnosePods(pods), nil
+}
+
+// podToDeployment maps a pod to the Deployment controlling its ReplicaSet
+func (r *HealthReconciler) podToDeployment(obj handler.MapObject) []reconcile.Request {
+	ref := metav1.GetControllerOf(obj.Meta)
+	if ref == nil || ref.Kind != "ReplicaSet" {
+		return nil
+	}
+	replicaSet := &appsv1.ReplicaSet{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: ref.Name, Namespace: obj.Meta.GetNamespace()}, replicaSet)
+	if err != nil {
+		return nil
+	}
+	ref = metav1.GetControllerOf(replicaSet)
+	if ref == nil || ref.Kind != "Deployment" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: ref.Name, Namespace: replicaSet.Namespace}}}
+}
+
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healths,verbs=get;list;watch
 // +kubebuilder:rbac:groups=common.amadev.ru,resources=healths/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
 
 func (r *HealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -81,8 +132,12 @@ func (r *HealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			log.Info("Object was deleted. Finalazer is not used. Skipping that case")
-			return ctrl.Result{}, nil
+			log.Info("Object was deleted, removing its component")
+			err = removeComponentsOf(ctx, r.Client, health, componentSource("Deployment", req.Name), nil)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
 		}
 
 		log.Error(err, "Failed to get an object")
@@ -92,27 +147,65 @@ func (r *HealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	app, component := getIdentity(found.ObjectMeta)
 	log.Info("Identification", "app", app, "component", component)
 
-	status := r.calculateStatus(found)
-
-	log.Info("Status", "status", status)
+	status := commonv1alpha1.ComponentStatus{
+		Status:     r.calculateStatus(found),
+		Generation: found.Generation,
+	}
+	switch {
+	case found.Spec.Paused:
+		status.Status = commonv1alpha1.StatusPaused
+		status.Reason = "Paused"
+	case scaledDown(found.Spec.Replicas, found.Status.Replicas):
+		status.Status = commonv1alpha1.StatusScaledDown
+		status.Reason, status.Message = scaledDownReason(found.ObjectMeta)
+	}
+	if status.Status == commonv1alpha1.StatusNotReady {
+		status.Diagnostics, err = r.diagnose(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to diagnose pods")
+		}
+	}
 
-	patch := getPatch(app, component, status, found.Generation)
+	log.Info("Status", "status", status.Status, "reason", status.Reason)
 
-	err = r.Status().Patch(
-		ctx,
-		health,
-		client.RawPatch(types.MergePatchType, patch))
+	now := time.Now()
+	status, wait := applyHysteresis(health, app, component, status, now)
+	status.Source = componentSource("Deployment", found.Name)
+	// the rollout is recorded as observed, regardless of the hysteresis
+	revision, err := deploymentRevision(ctx, r.Client, found)
+	if err != nil {
+		log.Error(err, "Failed to find the current ReplicaSet")
+	}
+	status.Rollout = trackRollout(health, app, component, commonv1alpha1.Rollout{
+		Generation: found.Generation,
+		Revision:   revision,
+		Images:     templateImages(&found.Spec.Template),
+	}, deploymentRolledOut(found), now)
+	patch, err := getPatch(health, app, component, status)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
 
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+	// a changed identity leaves the component reported before behind
+	err = removeComponentsOf(ctx, r.Client, health, status.Source, map[string]bool{app + "/" + component: true})
 	if err != nil {
 		log.Error(err, "Failed to update Health status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter(wait)}, nil
 }
 
 func (r *HealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.Deployment{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.podToDeployment)}).
 		Complete(r)
 }
@@ -0,0 +1,338 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+	// maxConcurrentProbes bounds the number of probes running at once
+	maxConcurrentProbes = 4
+)
+
+// HealthCheckReconciler runs the probes of HealthCheck objects on their
+// interval and reports the results as components of the namespace Health
+type HealthCheckReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// MaxCheckJobs bounds the number of check Jobs running at once across
+	// all namespaces, unlimited when zero
+	MaxCheckJobs int
+	// APIReader lists running check Jobs from the API server, the cache
+	// may not contain Jobs created by concurrent reconciles yet
+	APIReader client.Reader
+	// CheckServiceAccounts are the names of the ServiceAccounts Job checks
+	// may run as, besides the default one without a token
+	CheckServiceAccounts []string
+
+	// jobsMu serializes counting and creating check Jobs
+	jobsMu sync.Mutex
+}
+
+// checkIdentity returns the application and component a HealthCheck is
+// reported as
+func checkIdentity(check *commonv1alpha1.HealthCheck) (app, component string) {
+	app, _ = getIdentity(check.ObjectMeta)
+	if check.Spec.Application != "" {
+		app = applicationName(check.Spec.Application)
+	}
+	component = check.Name
+	if check.Spec.Component != "" {
+		component = check.Spec.Component
+	}
+	return app, component
+}
+
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healthchecks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healthchecks/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+func (r *HealthCheckReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("healthcheck", req.NamespacedName)
+	found := &commonv1alpha1.HealthCheck{}
+	log.Info("Got reconcile request")
+
+	err := r.Get(ctx, req.NamespacedName, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted, removing its component")
+			err = r.removeComponent(ctx, req)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
+		}
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	interval := defaultProbeInterval
+	if found.Spec.Interval != nil && found.Spec.Interval.Duration > 0 {
+		interval = found.Spec.Interval.Duration
+	}
+	if found.Spec.Job != nil {
+		return r.reconcileJob(ctx, log, found, interval)
+	}
+	// status updates trigger reconciles before the next probe is due, a
+	// changed spec is probed right away
+	if last := found.Status.LastProbeTime; last != nil && found.Status.ObservedGeneration == found.Generation {
+		if wait := time.Until(last.Add(interval)); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	timeout := defaultProbeTimeout
+	if found.Spec.Timeout != nil && found.Spec.Timeout.Duration > 0 {
+		timeout = found.Spec.Timeout.Duration
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	result := runProbe(probeCtx, &found.Spec, found.Namespace)
+	cancel()
+
+	now := metav1.Now()
+	status := commonv1alpha1.HealthCheckStatus{
+		Reason:        result.reason,
+		Message:       result.message,
+		Latency:       &metav1.Duration{Duration: result.latency.Round(time.Millisecond)},
+		LastProbeTime: &now,
+	}
+	if err := r.record(ctx, log, found, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// evaluationInterval is the longest time between two results of check, its
+// interval and timeout
+func evaluationInterval(check *commonv1alpha1.HealthCheck) time.Duration {
+	interval := defaultProbeInterval
+	if check.Spec.Interval != nil && check.Spec.Interval.Duration > 0 {
+		interval = check.Spec.Interval.Duration
+	}
+	timeout := defaultProbeTimeout
+	if check.Spec.Job != nil {
+		timeout = defaultCheckJobTimeout
+	}
+	if check.Spec.Timeout != nil && check.Spec.Timeout.Duration > 0 {
+		timeout = check.Spec.Timeout.Duration
+	}
+	return interval + timeout
+}
+
+// reconcileJob records the result of the last finished Job of a Job check,
+// starts a new Job when one is due and deletes old ones
+func (r *HealthCheckReconciler) reconcileJob(ctx context.Context, log logr.Logger, check *commonv1alpha1.HealthCheck, interval time.Duration) (ctrl.Result, error) {
+	jobs, err := r.checkJobs(ctx, check)
+	if err != nil {
+		log.Error(err, "Failed to list check Jobs")
+		return ctrl.Result{}, err
+	}
+
+	active := false
+	var last *batchv1.Job
+	for i := range jobs {
+		if finished, _ := jobFinished(&jobs[i]); finished.IsZero() {
+			active = true
+		} else if last == nil {
+			last = &jobs[i]
+		}
+	}
+	if last != nil && last.Name != check.Status.LastJob {
+		result, output, err := r.checkJobResult(ctx, last)
+		if err != nil {
+			log.Error(err, "Failed to get check Job result", "job", last.Name)
+			return ctrl.Result{}, err
+		}
+		finished, _ := jobFinished(last)
+		status := commonv1alpha1.HealthCheckStatus{
+			Reason:        result.reason,
+			Message:       result.message,
+			Latency:       &metav1.Duration{Duration: result.latency.Round(time.Second)},
+			Output:        output,
+			LastJob:       last.Name,
+			LastProbeTime: &metav1.Time{Time: finished},
+		}
+		if err := r.record(ctx, log, check, status); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.cleanupCheckJobs(ctx, check, jobs); err != nil {
+		log.Error(err, "Failed to delete old check Jobs")
+		return ctrl.Result{}, err
+	}
+	if active {
+		// the Job finishing triggers the next reconcile
+		return ctrl.Result{}, nil
+	}
+
+	// a changed spec is checked right away, the last probe time is used
+	// when no Job is kept
+	var lastRun time.Time
+	if len(jobs) > 0 {
+		lastRun = jobs[0].CreationTimestamp.Time
+	} else if check.Status.LastProbeTime != nil {
+		lastRun = check.Status.LastProbeTime.Time
+	}
+	if !lastRun.IsZero() && check.Status.ObservedGeneration == check.Generation {
+		if wait := time.Until(lastRun.Add(interval)); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+	if account := check.Spec.Job.ServiceAccountName; account != "" && !r.serviceAccountAllowed(account) {
+		log.Info("Service account is not allowed for check Jobs", "serviceAccount", account)
+		now := metav1.Now()
+		status := commonv1alpha1.HealthCheckStatus{
+			Reason:        "ServiceAccountNotAllowed",
+			Message:       fmt.Sprintf("service account %s is not allowed for check Jobs", account),
+			LastProbeTime: &now,
+		}
+		if err := r.record(ctx, log, check, status); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+	if r.MaxCheckJobs > 0 {
+		r.jobsMu.Lock()
+		defer r.jobsMu.Unlock()
+		running, err := r.runningCheckJobs(ctx)
+		if err != nil {
+			log.Error(err, "Failed to count running check Jobs")
+			return ctrl.Result{}, err
+		}
+		if running >= r.MaxCheckJobs {
+			log.Info("Too many check Jobs are running, delaying", "running", running)
+			return ctrl.Result{RequeueAfter: checkJobsBusyRetry}, nil
+		}
+	}
+
+	timeout := defaultCheckJobTimeout
+	if check.Spec.Timeout != nil && check.Spec.Timeout.Duration > 0 {
+		timeout = check.Spec.Timeout.Duration
+	}
+	job, err := r.newCheckJob(check, timeout)
+	if err != nil {
+		log.Error(err, "Failed to build check Job")
+		return ctrl.Result{}, err
+	}
+	err = r.Create(ctx, job)
+	if err != nil {
+		log.Error(err, "Failed to create check Job")
+		return ctrl.Result{}, err
+	}
+	log.Info("Started check Job", "job", job.Name)
+	return ctrl.Result{}, nil
+}
+
+// removeComponent removes the component of a deleted HealthCheck
+func (r *HealthCheckReconciler) removeComponent(ctx context.Context, req ctrl.Request) error {
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return removeComponentsOf(ctx, r.Client, health, componentSource("HealthCheck", req.Name), nil)
+}
+
+// record sets the result of a probe as the status of check and reports it
+// as a component of the namespace Health
+func (r *HealthCheckReconciler) record(ctx context.Context, log logr.Logger, check *commonv1alpha1.HealthCheck, status commonv1alpha1.HealthCheckStatus) error {
+	original := check.DeepCopy()
+	status.Status = commonv1alpha1.StatusReady
+	if status.Reason != "" {
+		status.Status = commonv1alpha1.StatusNotReady
+	}
+	status.Message = truncate(status.Message, maxDiagnosticMessage)
+	status.ObservedGeneration = check.Generation
+	check.Status = status
+	log.Info("Probed", "status", status.Status, "reason", status.Reason)
+
+	err := r.Status().Patch(ctx, check, client.MergeFrom(original))
+	if err != nil {
+		log.Error(err, "Failed to update HealthCheck status")
+		return err
+	}
+
+	health := &commonv1alpha1.Health{}
+	err = r.Get(ctx, types.NamespacedName{Name: "health", Namespace: check.Namespace}, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Health resource not found. Until health object is present in the namespace, summary will not be created")
+			return nil
+		}
+		log.Error(err, "Failed to get Health")
+		return err
+	}
+
+	// the next probe resolves a pending change, no extra requeue is needed
+	app, component := checkIdentity(check)
+	componentStatus, _ := applyHysteresis(health, app, component, commonv1alpha1.ComponentStatus{
+		Status:     status.Status,
+		Generation: check.Generation,
+		Reason:     status.Reason,
+		Message:    status.Message,
+		Interval:   &metav1.Duration{Duration: evaluationInterval(check)},
+	}, time.Now())
+	componentStatus.Source = componentSource("HealthCheck", check.Name)
+	patch, err := getPatch(health, app, component, componentStatus)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return err
+	}
+
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return err
+	}
+	// a changed application or component leaves the one reported before
+	err = removeComponentsOf(ctx, r.Client, health, componentStatus.Source, map[string]bool{app + "/" + component: true})
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return err
+	}
+	return nil
+}
+
+func (r *HealthCheckReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&commonv1alpha1.HealthCheck{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrentProbes}).
+		Complete(r)
+}
@@ -0,0 +1,222 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// ConditionDependenciesValid reports whether the dependencies declared in
+// the spec of a Health are free of cycles
+const ConditionDependenciesValid = "DependenciesValid"
+
+// HealthRollupReconciler calculates the fields of a Health which are derived
+// from the component statuses written by the workload reconcilers and the
+// spec, like the effective status of components with dependencies and the
+// rollup by criticality.
+type HealthRollupReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// Recorder emits the notifications of unhealthy components as Events,
+	// none are emitted when it is nil
+	Recorder record.EventRecorder
+}
+
+// rollup marks stale components unknown and silenced ones, sets the derived
+// fields of health like availability and incidents and returns when the
+// next component becomes stale or the next silence starts or ends, and the
+// components whose acknowledgement ended
+func (r *HealthRollupReconciler) rollup(health *commonv1alpha1.Health, silences []commonv1alpha1.HealthSilence, now time.Time) (time.Time, []string) {
+	next := earlier(markStale(health, now), applySilences(health, silences, now))
+	ended, err := applyAcknowledgements(health, now)
+	if err != nil {
+		r.Log.Error(err, "Ignoring acknowledgements", "health", types.NamespacedName{Name: health.Name, Namespace: health.Namespace})
+	}
+	updateAvailability(health, now)
+	recordIncidents(health, now)
+	edges := dependencyGraph(health)
+	healthy := map[string]bool{}
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			healthy[app+"/"+component] = health.Spec.Healthy(status)
+		}
+	}
+
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			key := app + "/" + component
+			status.EffectiveStatus = ""
+			status.ImpactedBy = nil
+			if _, ok := edges[key]; ok {
+				status.ImpactedBy = impactedBy(edges, key, healthy)
+				switch {
+				case !healthy[key]:
+					status.EffectiveStatus = commonv1alpha1.StatusNotReady
+				case len(status.ImpactedBy) > 0:
+					status.EffectiveStatus = commonv1alpha1.StatusImpacted
+				default:
+					status.EffectiveStatus = commonv1alpha1.StatusReady
+				}
+			}
+			components[component] = status
+		}
+	}
+
+	health.Status.Rollup = rollupHealth(health)
+	health.Status.Rollup.MTTR = meanTimeToRecovery(health)
+
+	existing := commonv1alpha1.FindCondition(health.Status.Conditions, ConditionDependenciesValid)
+	if len(health.Spec.Dependencies) == 0 && existing == nil {
+		return next, ended
+	}
+	condition := commonv1alpha1.Condition{
+		Type:               ConditionDependenciesValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             "NoCycles",
+		Message:            "Dependencies do not form cycles",
+		LastTransitionTime: metav1.Now(),
+	}
+	if cycle := findCycle(edges); cycle != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "DependencyCycle"
+		condition.Message = "Dependency cycle: " + strings.Join(cycle, " -> ")
+	}
+	if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message {
+		return next, ended
+	}
+	commonv1alpha1.SetCondition(&health.Status.Conditions, condition)
+	return next, ended
+}
+
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healths,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+func (r *HealthRollupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("healthrollup", req.NamespacedName)
+
+	if req.Name != "health" {
+		return ctrl.Result{}, nil
+	}
+
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, req.NamespacedName, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			deleteHealthMetrics(req.Namespace)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Health")
+		return ctrl.Result{}, err
+	}
+
+	silences := &commonv1alpha1.HealthSilenceList{}
+	err = r.List(ctx, silences, client.InNamespace(req.Namespace))
+	if err != nil {
+		log.Error(err, "Failed to list HealthSilences")
+		return ctrl.Result{}, err
+	}
+
+	original := health.DeepCopy()
+	now := time.Now()
+	next, ended := r.rollup(health, silences.Items, now)
+	notifications, renotify := notifyIncidents(health, now)
+	next = earlier(next, renotify)
+	// components are marked unknown when they become stale and silences
+	// start and end, even if nothing writes the Health anymore
+	result := ctrl.Result{}
+	if !next.IsZero() {
+		result.RequeueAfter = next.Sub(now) + time.Second
+	}
+	if len(ended) > 0 {
+		log.Info("Removing ended acknowledgements", "components", ended)
+		patch, err := removeAcknowledgementsPatch(health, ended)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// the patch response would overwrite the derived status
+		err = r.Patch(ctx, health.DeepCopy(), client.RawPatch(types.MergePatchType, patch))
+		if err != nil {
+			if errors.IsConflict(err) {
+				return ctrl.Result{Requeue: true}, nil
+			}
+			log.Error(err, "Failed to remove acknowledgements")
+			return ctrl.Result{}, err
+		}
+		// the patch changed the resource version, the derived status is
+		// calculated again from the new version instead of conflicting
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if equality.Semantic.DeepEqual(original.Status, health.Status) {
+		return result, nil
+	}
+	log.Info("Updating derived status")
+
+	// the update fails on a conflict with a concurrent patch of a
+	// component, the request is retried with the new version
+	err = r.Status().Update(ctx, health)
+	if err != nil {
+		if errors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	// the notifications are recorded in the incidents by the update, they
+	// are emitted only once it succeeded to not repeat them on a conflict
+	if r.Recorder != nil {
+		for _, n := range notifications {
+			r.Recorder.Event(health, corev1.EventTypeWarning, n.reason, n.message)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *HealthRollupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("healthrollup").
+		For(&commonv1alpha1.Health{}).
+		Watches(&source.Kind{Type: &commonv1alpha1.HealthSilence{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(namespaceHealth)}).
+		Complete(r)
+}
+
+// namespaceHealth maps an object to the Health of its namespace
+func namespaceHealth(obj handler.MapObject) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "health", Namespace: obj.Meta.GetNamespace()}}}
+}
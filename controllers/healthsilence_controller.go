@@ -0,0 +1,131 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// HealthSilenceReconciler reports the state of HealthSilence objects and the
+// components they silence, and deletes them once they end. The components
+// are marked silenced by the HealthRollupReconciler.
+type HealthSilenceReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healthsilences,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=common.amadev.ru,resources=healthsilences/status,verbs=get;update;patch
+
+func (r *HealthSilenceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("healthsilence", req.NamespacedName)
+	found := &commonv1alpha1.HealthSilence{}
+	log.Info("Got reconcile request")
+
+	err := r.Get(ctx, req.NamespacedName, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted. Finalazer is not used. Skipping that case")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	if !now.Before(found.Spec.EndsAt.Time) {
+		log.Info("Deleting expired silence")
+		err = r.Delete(ctx, found)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete HealthSilence")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	original := found.DeepCopy()
+	found.Status = commonv1alpha1.HealthSilenceStatus{State: commonv1alpha1.SilencePending}
+	requeue := silenceStart(found).Sub(now)
+	if silenceActive(found, now) {
+		found.Status.State = commonv1alpha1.SilenceActive
+		requeue = found.Spec.EndsAt.Sub(now)
+
+		health := &commonv1alpha1.Health{}
+		err = r.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get Health")
+			return ctrl.Result{}, err
+		}
+		var silenced []string
+		for app, components := range health.Status.Applications {
+			for component := range components {
+				if silenceMatches(found, app, component) {
+					silenced = append(silenced, app+"/"+component)
+				}
+			}
+		}
+		found.Status.Silenced = firstComponents(silenced)
+	}
+
+	if !equality.Semantic.DeepEqual(original.Status, found.Status) {
+		err = r.Status().Patch(ctx, found, client.MergeFrom(original))
+		if err != nil {
+			log.Error(err, "Failed to update HealthSilence status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+// namespaceSilences maps a Health to the HealthSilences of its namespace
+func (r *HealthSilenceReconciler) namespaceSilences(obj handler.MapObject) []reconcile.Request {
+	silences := &commonv1alpha1.HealthSilenceList{}
+	err := r.List(context.Background(), silences, client.InNamespace(obj.Meta.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "Failed to list HealthSilences")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, silence := range silences.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: silence.Name, Namespace: silence.Namespace}})
+	}
+	return requests
+}
+
+func (r *HealthSilenceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&commonv1alpha1.HealthSilence{}).
+		Watches(&source.Kind{Type: &commonv1alpha1.Health{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.namespaceSilences)}).
+		Complete(r)
+}
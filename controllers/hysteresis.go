@@ -0,0 +1,121 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const defaultFlappingWindow = 10 * time.Minute
+
+// applyHysteresis returns the status of a component to report for the newly
+// evaluated status, given the status stored in health. A change between
+// healthy and unhealthy is only reported once it lasted for the delay
+// configured in the spec, until then the stored status is reported again
+// with the evaluated one as pending. The returned duration is when the
+// component must be evaluated again for a pending change, zero when none is
+// pending.
+func applyHysteresis(health *commonv1alpha1.Health, app, component string, status commonv1alpha1.ComponentStatus, now time.Time) (commonv1alpha1.ComponentStatus, time.Duration) {
+	h := health.Spec.Hysteresis
+	previous, ok := health.Status.Applications[app][component]
+	if h == nil || !ok {
+		return status, 0
+	}
+	// endpoints are written by the Service reconciler without hysteresis
+	isHealthy := func(s commonv1alpha1.ComponentStatus) bool {
+		s.Endpoints = nil
+		return health.Spec.Healthy(s)
+	}
+	healthy := isHealthy(status)
+	evaluated := previous
+	if previous.PendingStatus != "" {
+		evaluated.Status = previous.PendingStatus
+	}
+
+	transitions := recentTransitions(h, previous.Transitions, now)
+	if h.FlappingTransitions > 0 && known(evaluated) && known(status) && isHealthy(evaluated) != healthy {
+		transitions = append(transitions, metav1.NewTime(now))
+	}
+	if n := int(h.FlappingTransitions); len(transitions) > n {
+		transitions = transitions[len(transitions)-n:]
+	}
+
+	var delay time.Duration
+	switch {
+	case healthy && h.RecoverAfter != nil:
+		delay = h.RecoverAfter.Duration
+	case !healthy && h.DownAfter != nil:
+		delay = h.DownAfter.Duration
+	}
+	var wait time.Duration
+	if delay > 0 && known(previous) && known(status) && isHealthy(previous) != healthy {
+		since := now
+		if previous.PendingSince != nil && isHealthy(evaluated) == healthy {
+			since = previous.PendingSince.Time
+		}
+		if wait = since.Add(delay).Sub(now); wait > 0 {
+			// fields written by other reconcilers are left alone
+			held := withoutSharedFields(previous)
+			held.PendingStatus = status.Status
+			held.PendingSince = &metav1.Time{Time: since}
+			status = held
+		} else {
+			wait = 0
+		}
+	}
+
+	status.Transitions = transitions
+	status.Flapping = h.FlappingTransitions > 0 && len(transitions) >= int(h.FlappingTransitions)
+	return status, wait
+}
+
+// recentTransitions drops the transitions older than the flapping window
+func recentTransitions(h *commonv1alpha1.Hysteresis, transitions []metav1.Time, now time.Time) []metav1.Time {
+	if h.FlappingTransitions <= 0 {
+		return nil
+	}
+	window := defaultFlappingWindow
+	if h.FlappingWindow != nil && h.FlappingWindow.Duration > 0 {
+		window = h.FlappingWindow.Duration
+	}
+	var recent []metav1.Time
+	for _, t := range transitions {
+		if now.Sub(t.Time) < window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// known reports whether the state of a component could be determined,
+// changes from or to unknown are reported immediately
+func known(status commonv1alpha1.ComponentStatus) bool {
+	return status.Status != commonv1alpha1.StatusUnknown
+}
+
+// requeueAfter is when a workload must be evaluated again, wait for a
+// pending change or the resync period
+func requeueAfter(wait time.Duration) time.Duration {
+	if wait > 0 && wait < resyncPeriod {
+		return wait
+	}
+	return resyncPeriod
+}
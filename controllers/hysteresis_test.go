@@ -0,0 +1,141 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestApplyHysteresis(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	minute := &metav1.Duration{Duration: time.Minute}
+	ready := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady}
+	notReady := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Reason: "Unavailable"}
+	unknown := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusUnknown}
+
+	tests := []struct {
+		name       string
+		hysteresis *commonv1alpha1.Hysteresis
+		previous   *commonv1alpha1.ComponentStatus
+		status     commonv1alpha1.ComponentStatus
+		reported   string
+		pending    string
+		wait       time.Duration
+		flapping   bool
+	}{
+		{
+			name:     "no hysteresis",
+			previous: &ready,
+			status:   notReady,
+			reported: commonv1alpha1.StatusNotReady,
+		},
+		{
+			name:       "new component",
+			hysteresis: &commonv1alpha1.Hysteresis{DownAfter: minute},
+			status:     notReady,
+			reported:   commonv1alpha1.StatusNotReady,
+		},
+		{
+			name:       "failure is held",
+			hysteresis: &commonv1alpha1.Hysteresis{DownAfter: minute},
+			previous:   &ready,
+			status:     notReady,
+			reported:   commonv1alpha1.StatusReady,
+			pending:    commonv1alpha1.StatusNotReady,
+			wait:       time.Minute,
+		},
+		{
+			name:       "failure lasting the delay is reported",
+			hysteresis: &commonv1alpha1.Hysteresis{DownAfter: minute},
+			previous: &commonv1alpha1.ComponentStatus{
+				Status:        commonv1alpha1.StatusReady,
+				PendingStatus: commonv1alpha1.StatusNotReady,
+				PendingSince:  &metav1.Time{Time: now.Add(-2 * time.Minute)},
+			},
+			status:   notReady,
+			reported: commonv1alpha1.StatusNotReady,
+		},
+		{
+			name:       "recovery is reported immediately without its delay",
+			hysteresis: &commonv1alpha1.Hysteresis{DownAfter: minute},
+			previous:   &notReady,
+			status:     ready,
+			reported:   commonv1alpha1.StatusReady,
+		},
+		{
+			name:       "change to unknown is reported immediately",
+			hysteresis: &commonv1alpha1.Hysteresis{DownAfter: minute},
+			previous:   &ready,
+			status:     unknown,
+			reported:   commonv1alpha1.StatusUnknown,
+		},
+		{
+			name:       "flapping",
+			hysteresis: &commonv1alpha1.Hysteresis{FlappingTransitions: 2},
+			previous: &commonv1alpha1.ComponentStatus{
+				Status:      commonv1alpha1.StatusReady,
+				Transitions: []metav1.Time{{Time: now.Add(-time.Minute)}},
+			},
+			status:   notReady,
+			reported: commonv1alpha1.StatusNotReady,
+			flapping: true,
+		},
+		{
+			name:       "transitions out of the window are dropped",
+			hysteresis: &commonv1alpha1.Hysteresis{FlappingTransitions: 2},
+			previous: &commonv1alpha1.ComponentStatus{
+				Status:      commonv1alpha1.StatusReady,
+				Transitions: []metav1.Time{{Time: now.Add(-time.Hour)}},
+			},
+			status:   notReady,
+			reported: commonv1alpha1.StatusNotReady,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Spec.Hysteresis = test.hysteresis
+			if test.previous != nil {
+				previous := *test.previous
+				previous.SilencedBy = "maintenance"
+				health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+					"nova": {"api": previous},
+				}
+			}
+
+			status, wait := applyHysteresis(health, "nova", "api", test.status, now)
+			if status.Status != test.reported || status.PendingStatus != test.pending {
+				t.Errorf("status %s pending %s, want %s pending %s",
+					status.Status, status.PendingStatus, test.reported, test.pending)
+			}
+			if wait != test.wait {
+				t.Errorf("wait %s, want %s", wait, test.wait)
+			}
+			if status.Flapping != test.flapping {
+				t.Errorf("flapping %v, want %v", status.Flapping, test.flapping)
+			}
+			if status.SilencedBy != "" {
+				t.Errorf("silencedBy %s is written by the rollup", status.SilencedBy)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// maxIncidents bounds the incidents kept per component
+const maxIncidents = 10
+
+var mttrSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "health_application_mttr_seconds",
+	Help: "Mean time to recovery of the recorded incidents of an application",
+}, []string{"namespace", "application"})
+
+func init() {
+	metrics.Registry.MustRegister(mttrSeconds)
+}
+
+// mttrSeries are the applications the mean time to recovery is set for
+var mttrSeries metricSeries
+
+// recordIncidents opens an incident for each component of health which
+// became unhealthy and ends the open incident of each one which recovered.
+// Unknown components keep their incidents as they are, silenced ones do not
+// open new incidents.
+func recordIncidents(health *commonv1alpha1.Health, now time.Time) {
+	for _, components := range health.Status.Applications {
+		for component, status := range components {
+			if status.Status == commonv1alpha1.StatusUnknown {
+				continue
+			}
+			var open *commonv1alpha1.Incident
+			if n := len(status.Incidents); n > 0 && status.Incidents[n-1].End == nil {
+				open = &status.Incidents[n-1]
+			}
+			healthy := health.Spec.Healthy(status)
+			switch {
+			case healthy && open != nil:
+				incidents := make([]commonv1alpha1.Incident, len(status.Incidents))
+				copy(incidents, status.Incidents)
+				last := &incidents[len(incidents)-1]
+				last.End = &metav1.Time{Time: now}
+				last.Duration = now.Sub(last.Start.Time).Round(time.Second).String()
+				status.Incidents = incidents
+			case !healthy && open == nil && status.SilencedBy == "":
+				incidents := append([]commonv1alpha1.Incident{}, status.Incidents...)
+				incidents = append(incidents, commonv1alpha1.Incident{
+					Start:      metav1.NewTime(now),
+					Status:     status.Status,
+					Reason:     status.Reason,
+					Message:    status.Message,
+					Generation: status.Generation,
+				})
+				if len(incidents) > maxIncidents {
+					incidents = incidents[len(incidents)-maxIncidents:]
+				}
+				status.Incidents = incidents
+			default:
+				continue
+			}
+			components[component] = status
+		}
+	}
+}
+
+// meanTimeToRecovery returns the mean duration of the ended incidents of
+// the components of each application of health which had one
+func meanTimeToRecovery(health *commonv1alpha1.Health) map[string]string {
+	var mttr map[string]string
+	var series [][]string
+	for app, components := range health.Status.Applications {
+		var total time.Duration
+		ended := 0
+		for _, status := range components {
+			for _, incident := range status.Incidents {
+				if incident.End == nil {
+					continue
+				}
+				total += incident.End.Sub(incident.Start.Time)
+				ended++
+			}
+		}
+		if ended == 0 {
+			continue
+		}
+		mean := total / time.Duration(ended)
+		mttrSeconds.WithLabelValues(health.Namespace, app).Set(mean.Seconds())
+		series = append(series, []string{app})
+		if mttr == nil {
+			mttr = map[string]string{}
+		}
+		mttr[app] = mean.Round(time.Second).String()
+	}
+	for _, labels := range mttrSeries.update(health.Namespace, series) {
+		mttrSeconds.DeleteLabelValues(health.Namespace, labels[0])
+	}
+	return mttr
+}
+
+// renotifyInterval is how often the failure of a component is notified
+// again while it is neither acknowledged nor silenced
+const renotifyInterval = time.Hour
+
+// incidentNotification is an Event about an unhealthy component
+type incidentNotification struct {
+	reason  string
+	message string
+}
+
+// notifyIncidents returns the notifications due now for the open incidents
+// of health and records them in the incidents. An incident is notified when
+// it opens and again every renotifyInterval while its failure is neither
+// acknowledged nor silenced. It also returns when the next repeat is due,
+// zero when none will be.
+func notifyIncidents(health *commonv1alpha1.Health, now time.Time) ([]incidentNotification, time.Time) {
+	var notifications []incidentNotification
+	var next time.Time
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			n := len(status.Incidents)
+			if n == 0 || status.Incidents[n-1].End != nil || status.Acknowledgement != nil || status.SilencedBy != "" {
+				continue
+			}
+			incident := status.Incidents[n-1]
+			reason := "ComponentUnhealthy"
+			if incident.Notified != nil {
+				due := incident.Notified.Add(renotifyInterval)
+				if due.After(now) {
+					next = earlier(next, due)
+					continue
+				}
+				reason = "ComponentStillUnhealthy"
+			}
+			message := fmt.Sprintf("%s/%s is %s since %s", app, component, status.Status, incident.Start.UTC().Format(time.RFC3339))
+			if status.Reason != "" {
+				message += ": " + status.Reason
+			}
+			if status.Message != "" {
+				message += ": " + status.Message
+			}
+			notifications = append(notifications, incidentNotification{reason: reason, message: truncate(message, maxDiagnosticMessage)})
+			next = earlier(next, now.Add(renotifyInterval))
+
+			incidents := append([]commonv1alpha1.Incident{}, status.Incidents...)
+			incidents[n-1].Notified = &metav1.Time{Time: now}
+			status.Incidents = incidents
+			components[component] = status
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].message < notifications[j].message })
+	return notifications, next
+}
@@ -0,0 +1,235 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestRecordIncidents(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	open := commonv1alpha1.Incident{Start: metav1.NewTime(now.Add(-10 * time.Minute)), Status: commonv1alpha1.StatusNotReady}
+	ended := commonv1alpha1.Incident{
+		Start:  metav1.NewTime(now.Add(-time.Hour)),
+		End:    &metav1.Time{Time: now.Add(-50 * time.Minute)},
+		Status: commonv1alpha1.StatusNotReady,
+	}
+	tests := []struct {
+		name      string
+		status    commonv1alpha1.ComponentStatus
+		incidents int
+		open      bool
+		duration  string
+	}{
+		{
+			name:   "healthy",
+			status: commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady},
+		},
+		{
+			name:      "failure opens an incident",
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Incidents: []commonv1alpha1.Incident{ended}},
+			incidents: 2,
+			open:      true,
+		},
+		{
+			name:      "recovery ends the incident",
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Incidents: []commonv1alpha1.Incident{open}},
+			incidents: 1,
+			duration:  "10m0s",
+		},
+		{
+			name:      "ongoing failure keeps the incident",
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusDown, Incidents: []commonv1alpha1.Incident{open}},
+			incidents: 1,
+			open:      true,
+		},
+		{
+			name:      "unknown keeps the incident",
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusUnknown, Incidents: []commonv1alpha1.Incident{open}},
+			incidents: 1,
+			open:      true,
+		},
+		{
+			name:   "silenced failure opens none",
+			status: commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, SilencedBy: "upgrade"},
+		},
+		{
+			name: "incidents are bounded",
+			status: commonv1alpha1.ComponentStatus{
+				Status:    commonv1alpha1.StatusNotReady,
+				Incidents: []commonv1alpha1.Incident{ended, ended, ended, ended, ended, ended, ended, ended, ended, ended},
+			},
+			incidents: maxIncidents,
+			open:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+				"nova": {"api": test.status},
+			}
+			recordIncidents(health, now)
+			incidents := health.Status.Applications["nova"]["api"].Incidents
+			if len(incidents) != test.incidents {
+				t.Fatalf("%d incidents, want %d", len(incidents), test.incidents)
+			}
+			if len(incidents) == 0 {
+				return
+			}
+			last := incidents[len(incidents)-1]
+			if (last.End == nil) != test.open || last.Duration != test.duration {
+				t.Errorf("last incident %+v, want open %v duration %q", last, test.open, test.duration)
+			}
+		})
+	}
+}
+
+func TestMeanTimeToRecovery(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	incident := func(start, end time.Duration) commonv1alpha1.Incident {
+		return commonv1alpha1.Incident{Start: metav1.NewTime(now.Add(-start)), End: &metav1.Time{Time: now.Add(-end)}}
+	}
+	health := &commonv1alpha1.Health{}
+	health.Namespace = "mttr-test"
+	defer deleteHealthMetrics(health.Namespace)
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Incidents: []commonv1alpha1.Incident{incident(time.Hour, 50*time.Minute)}},
+			"scheduler": {Incidents: []commonv1alpha1.Incident{incident(time.Hour, 30*time.Minute), {Start: metav1.NewTime(now)}}},
+		},
+		"glance": {
+			"api": {Status: commonv1alpha1.StatusReady},
+		},
+	}
+	mttr := meanTimeToRecovery(health)
+	if len(mttr) != 1 || mttr["nova"] != "20m0s" {
+		t.Errorf("mttr %v, want nova 20m0s", mttr)
+	}
+	if n := seriesCount(mttrSeconds); n != 1 {
+		t.Errorf("%d series, want 1", n)
+	}
+
+	delete(health.Status.Applications, "nova")
+	if mttr := meanTimeToRecovery(health); mttr != nil {
+		t.Errorf("mttr %v without incidents", mttr)
+	}
+	if n := seriesCount(mttrSeconds); n != 0 {
+		t.Errorf("%d series of removed applications", n)
+	}
+}
+
+func TestNotifyIncidents(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	open := commonv1alpha1.Incident{Start: metav1.NewTime(now.Add(-2 * time.Hour)), Status: commonv1alpha1.StatusNotReady}
+	notified := open
+	notified.Notified = &metav1.Time{Time: now.Add(-10 * time.Minute)}
+	overdue := open
+	overdue.Notified = &metav1.Time{Time: now.Add(-renotifyInterval)}
+	ended := open
+	ended.End = &metav1.Time{Time: now.Add(-time.Hour)}
+	acknowledgement := &commonv1alpha1.Acknowledgement{By: "oncall", Time: metav1.NewTime(now.Add(-time.Minute))}
+	tests := []struct {
+		name     string
+		status   commonv1alpha1.ComponentStatus
+		reason   string
+		notified bool
+		next     time.Time
+	}{
+		{
+			name:   "healthy",
+			status: commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Incidents: []commonv1alpha1.Incident{ended}},
+		},
+		{
+			name:     "new incident",
+			status:   commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Incidents: []commonv1alpha1.Incident{open}},
+			reason:   "ComponentUnhealthy",
+			notified: true,
+			next:     now.Add(renotifyInterval),
+		},
+		{
+			name:     "notified recently",
+			status:   commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Incidents: []commonv1alpha1.Incident{notified}},
+			notified: true,
+			next:     now.Add(renotifyInterval - 10*time.Minute),
+		},
+		{
+			name:     "repeat is due",
+			status:   commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Incidents: []commonv1alpha1.Incident{overdue}},
+			reason:   "ComponentStillUnhealthy",
+			notified: true,
+			next:     now.Add(renotifyInterval),
+		},
+		{
+			name: "acknowledged failure is not repeated",
+			status: commonv1alpha1.ComponentStatus{
+				Status:          commonv1alpha1.StatusNotReady,
+				Incidents:       []commonv1alpha1.Incident{overdue},
+				Acknowledgement: acknowledgement,
+			},
+			notified: true,
+		},
+		{
+			name: "acknowledged failure is not notified",
+			status: commonv1alpha1.ComponentStatus{
+				Status:          commonv1alpha1.StatusNotReady,
+				Incidents:       []commonv1alpha1.Incident{open},
+				Acknowledgement: acknowledgement,
+			},
+		},
+		{
+			name: "silenced failure is not repeated",
+			status: commonv1alpha1.ComponentStatus{
+				Status:     commonv1alpha1.StatusNotReady,
+				Incidents:  []commonv1alpha1.Incident{overdue},
+				SilencedBy: "upgrade",
+			},
+			notified: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+				"nova": {"api": test.status},
+			}
+			notifications, next := notifyIncidents(health, now)
+			switch {
+			case test.reason == "" && len(notifications) > 0:
+				t.Errorf("notifications %+v, want none", notifications)
+			case test.reason != "" && (len(notifications) != 1 || notifications[0].reason != test.reason):
+				t.Errorf("notifications %+v, want one %s", notifications, test.reason)
+			}
+			if !next.Equal(test.next) {
+				t.Errorf("next %v, want %v", next, test.next)
+			}
+			incidents := health.Status.Applications["nova"]["api"].Incidents
+			last := incidents[len(incidents)-1]
+			if (last.Notified != nil) != test.notified {
+				t.Errorf("notified %v, want %v", last.Notified, test.notified)
+			}
+			if test.reason != "" && !last.Notified.Time.Equal(now) {
+				t.Errorf("notified %v, want %v", last.Notified, now)
+			}
+		})
+	}
+}
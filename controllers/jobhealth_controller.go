@@ -0,0 +1,152 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+type JobHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// calculateStatus reports a succeeded Job as ready, a running or failed
+// one as notready with the reason
+func (r *JobHealthReconciler) calculateStatus(obj *batchv1.Job) (status, reason, message string) {
+	for _, c := range obj.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return commonv1alpha1.StatusReady, "Succeeded", ""
+		case batchv1.JobFailed:
+			return commonv1alpha1.StatusNotReady, c.Reason, c.Message
+		}
+	}
+	return commonv1alpha1.StatusNotReady, "Running", ""
+}
+
+// diagnose summarizes the pods controlled by obj
+func (r *JobHealthReconciler) diagnose(ctx context.Context, obj *batchv1.Job) ([]commonv1alpha1.PodDiagnostic, error) {
+	pods, err := ownedPods(ctx, r.Client, obj.Namespace, obj.Spec.Selector, map[types.UID]bool{obj.UID: true})
+	if err != nil {
+		return nil, err
+	}
+	return diagnosePods(pods), nil
+}
+
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+
+func (r *JobHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("jobhealth", req.NamespacedName)
+	found := &batchv1.Job{}
+	log.Info("Got reconcile request")
+
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Health resource not found. Until health object is present in the namespace, summary will not be created")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Health")
+		return ctrl.Result{}, err
+	}
+
+	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted, removing its component")
+			err = removeComponentsOf(ctx, r.Client, health, componentSource("Job", req.Name), nil)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
+		}
+
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	if ref := metav1.GetControllerOf(found); ref != nil && ref.Kind == "CronJob" {
+		log.Info("Job is reported as part of its CronJob")
+		return ctrl.Result{}, nil
+	}
+	if ref := metav1.GetControllerOf(found); ref != nil && ref.Kind == "HealthCheck" {
+		log.Info("Job is reported as part of its HealthCheck")
+		return ctrl.Result{}, nil
+	}
+
+	app, component := getIdentity(found.ObjectMeta)
+	log.Info("Identification", "app", app, "component", component)
+
+	status := commonv1alpha1.ComponentStatus{Generation: found.Generation}
+	status.Status, status.Reason, status.Message = r.calculateStatus(found)
+	if status.Status != commonv1alpha1.StatusReady {
+		status.Diagnostics, err = r.diagnose(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to diagnose pods")
+		}
+	}
+
+	log.Info("Status", "status", status.Status, "reason", status.Reason)
+
+	status, wait := applyHysteresis(health, app, component, status, time.Now())
+	status.Source = componentSource("Job", found.Name)
+	patch, err := getPatch(health, app, component, status)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
+
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+	// a changed identity leaves the component reported before behind
+	err = removeComponentsOf(ctx, r.Client, health, status.Source, map[string]bool{app + "/" + component: true})
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter(wait)}, nil
+}
+
+func (r *JobHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&batchv1.Job{}).
+		Complete(r)
+}
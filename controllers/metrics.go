@@ -0,0 +1,74 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"sync"
+)
+
+// metricSeries tracks the label values of the series set for the Health
+// of each namespace, so that the series of removed components and Healths
+// are deleted instead of reporting their last value forever
+type metricSeries struct {
+	mu     sync.Mutex
+	series map[string]map[string][]string
+}
+
+// update records the label values set for namespace and returns the ones
+// set before which are gone
+func (m *metricSeries) update(namespace string, current [][]string) [][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := map[string][]string{}
+	for _, labels := range current {
+		series[strings.Join(labels, "/")] = labels
+	}
+	var gone [][]string
+	for key, labels := range m.series[namespace] {
+		if _, ok := series[key]; !ok {
+			gone = append(gone, labels)
+		}
+	}
+	if m.series == nil {
+		m.series = map[string]map[string][]string{}
+	}
+	m.series[namespace] = series
+	return gone
+}
+
+// remove forgets namespace and returns the label values set for it
+func (m *metricSeries) remove(namespace string) [][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var gone [][]string
+	for _, labels := range m.series[namespace] {
+		gone = append(gone, labels)
+	}
+	delete(m.series, namespace)
+	return gone
+}
+
+// deleteHealthMetrics deletes the series of the Health of namespace
+func deleteHealthMetrics(namespace string) {
+	for _, labels := range availabilitySeries.remove(namespace) {
+		deleteAvailabilityMetrics(namespace, labels[0], labels[1])
+	}
+	for _, labels := range mttrSeries.remove(namespace) {
+		mttrSeconds.DeleteLabelValues(namespace, labels[0])
+	}
+}
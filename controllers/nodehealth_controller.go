@@ -0,0 +1,150 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// NodeHealthReconciler publishes the groups of nodes as components of the
+// nodes application of every Health whose spec enables it, so that they
+// can be used in criticality, dependencies, silences and acknowledgements
+// like any other component
+type NodeHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// nodeGroupStatus returns the component status of a node group
+func nodeGroupStatus(summary commonv1alpha1.NodeGroupSummary) commonv1alpha1.ComponentStatus {
+	status := commonv1alpha1.ComponentStatus{Status: summary.Status, NodeGroup: &summary}
+	if summary.Status != commonv1alpha1.StatusReady {
+		status.Reason = "NodesNotReady"
+		status.Message = "nodes not ready or under pressure: " + strings.Join(summary.NotReadyNodes, ", ")
+	}
+	return status
+}
+
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+func (r *NodeHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("nodehealth", req.NamespacedName)
+	found := &commonv1alpha1.Health{}
+	log.Info("Got reconcile request")
+
+	err := r.Get(ctx, req.NamespacedName, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted. Finalazer is not used. Skipping that case")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	var groups map[string]commonv1alpha1.NodeGroupSummary
+	if found.Spec.Nodes != nil {
+		nodes := &corev1.NodeList{}
+		err = r.List(ctx, nodes)
+		if err != nil {
+			log.Error(err, "Failed to list nodes")
+			return ctrl.Result{}, err
+		}
+		groups = summarizeNodes(nodes.Items, found.Spec.Nodes.GroupByLabel)
+	}
+
+	source := componentSource("Health", found.Name) + "/nodes"
+	keep := map[string]bool{}
+	for group, summary := range groups {
+		status := nodeGroupStatus(summary)
+		status.Generation = found.Generation
+		// the next resync resolves a pending change
+		status, _ = applyHysteresis(found, commonv1alpha1.NodesApplication, group, status, time.Now())
+		status.Source = source
+		keep[commonv1alpha1.NodesApplication+"/"+group] = true
+		patch, err := getPatch(found, commonv1alpha1.NodesApplication, group, status)
+		if err != nil {
+			log.Error(err, "Failed to build Health status patch")
+			return ctrl.Result{}, err
+		}
+		err = patchHealthStatus(ctx, r.Client, found, patch)
+		if err != nil {
+			log.Error(err, "Failed to update Health status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// groups without nodes left, or all of them once disabled, are removed
+	err = removeComponentsOf(ctx, r.Client, found, source, keep)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	if found.Spec.Nodes == nil {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: resyncPeriod}, nil
+}
+
+// nodeHealths maps a node to the Healths publishing node groups
+func (r *NodeHealthReconciler) nodeHealths(obj handler.MapObject) []reconcile.Request {
+	healths := &commonv1alpha1.HealthList{}
+	err := r.List(context.Background(), healths)
+	if err != nil {
+		r.Log.Error(err, "Failed to list Health")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, health := range healths.Items {
+		if health.Spec.Nodes != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: health.Name, Namespace: health.Namespace}})
+		}
+	}
+	return requests
+}
+
+func (r *NodeHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// status updates are ignored, node groups are published when nodes or
+	// the spec change and on the resync period
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("nodehealth").
+		For(&commonv1alpha1.Health{}, ctrlbuilder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.nodeHealths)},
+			ctrlbuilder.WithPredicates(predicate.Funcs{UpdateFunc: nodeStateChanged})).
+		Complete(r)
+}
@@ -0,0 +1,218 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// daemonTolerated are the taints tolerated by every DaemonSet pod, the
+// DaemonSet controller adds tolerations for them
+var daemonTolerated = map[string]bool{
+	corev1.TaintNodeNotReady:           true,
+	corev1.TaintNodeUnreachable:        true,
+	corev1.TaintNodeDiskPressure:       true,
+	corev1.TaintNodeMemoryPressure:     true,
+	corev1.TaintNodePIDPressure:        true,
+	corev1.TaintNodeUnschedulable:      true,
+	corev1.TaintNodeNetworkUnavailable: true,
+}
+
+// nodeUnavailable reports whether node is cordoned or not ready
+func nodeUnavailable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status != corev1.ConditionTrue
+		}
+	}
+	return true
+}
+
+// nodeConditions returns the status of the Ready and pressure conditions
+// of node
+func nodeConditions(node *corev1.Node) map[corev1.NodeConditionType]corev1.ConditionStatus {
+	conditions := map[corev1.NodeConditionType]corev1.ConditionStatus{}
+	for _, c := range node.Status.Conditions {
+		switch c.Type {
+		case corev1.NodeReady, corev1.NodeMemoryPressure, corev1.NodeDiskPressure, corev1.NodePIDPressure:
+			conditions[c.Type] = c.Status
+		}
+	}
+	return conditions
+}
+
+// nodeStateChanged filters out node updates, mostly heartbeats, which
+// change neither readiness, pressure, scheduling nor labels of a node
+func nodeStateChanged(e event.UpdateEvent) bool {
+	oldNode, ok := e.ObjectOld.(*corev1.Node)
+	if !ok {
+		return true
+	}
+	newNode, ok := e.ObjectNew.(*corev1.Node)
+	if !ok {
+		return true
+	}
+	return oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable ||
+		!equality.Semantic.DeepEqual(nodeConditions(oldNode), nodeConditions(newNode)) ||
+		!equality.Semantic.DeepEqual(oldNode.Labels, newNode.Labels) ||
+		!equality.Semantic.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints)
+}
+
+// nodeRunsPod reports whether a DaemonSet pod with spec should run on node
+func nodeRunsPod(node *corev1.Node, spec *corev1.PodSpec) bool {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if affinity := spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil && !matchNodeSelector(node, required) {
+			return false
+		}
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || daemonTolerated[taint.Key] {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelectorOperators maps node selector operators to label selector ones
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// matchNodeSelector reports whether the labels of node match one of the
+// terms of selector. Field selectors of the terms are not supported and
+// are considered matching.
+func matchNodeSelector(node *corev1.Node, selector *corev1.NodeSelector) bool {
+	for _, term := range selector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		matches := true
+		for _, expression := range term.MatchExpressions {
+			operator, ok := nodeSelectorOperators[expression.Operator]
+			if !ok {
+				matches = false
+				break
+			}
+			requirement, err := labels.NewRequirement(expression.Key, operator, expression.Values)
+			if err != nil || !requirement.Matches(labels.Set(node.Labels)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeNodes rolls up nodes into groups by the value of label
+func summarizeNodes(nodes []corev1.Node, label string) map[string]commonv1alpha1.NodeGroupSummary {
+	summaries := map[string]*commonv1alpha1.NodeGroupSummary{}
+	notReady := map[string][]string{}
+	for i := range nodes {
+		node := &nodes[i]
+		group := "all"
+		if label != "" {
+			var ok bool
+			if group, ok = node.Labels[label]; !ok {
+				group = "none"
+			}
+		}
+		summary, ok := summaries[group]
+		if !ok {
+			summary = &commonv1alpha1.NodeGroupSummary{Status: commonv1alpha1.StatusReady}
+			summaries[group] = summary
+		}
+
+		conditions := nodeConditions(node)
+		healthy := true
+		if conditions[corev1.NodeReady] == corev1.ConditionTrue {
+			summary.Ready++
+		} else {
+			summary.NotReady++
+			healthy = false
+		}
+		if conditions[corev1.NodeMemoryPressure] == corev1.ConditionTrue {
+			summary.MemoryPressure++
+			healthy = false
+		}
+		if conditions[corev1.NodeDiskPressure] == corev1.ConditionTrue {
+			summary.DiskPressure++
+			healthy = false
+		}
+		if conditions[corev1.NodePIDPressure] == corev1.ConditionTrue {
+			summary.PIDPressure++
+			healthy = false
+		}
+		if node.Spec.Unschedulable {
+			summary.Cordoned++
+		}
+		for _, taint := range node.Spec.Taints {
+			if summary.Taints == nil {
+				summary.Taints = map[string]int32{}
+			}
+			summary.Taints[taint.Key+":"+string(taint.Effect)]++
+		}
+		if !healthy {
+			summary.Status = commonv1alpha1.StatusNotReady
+			notReady[group] = append(notReady[group], node.Name)
+		}
+	}
+
+	result := make(map[string]commonv1alpha1.NodeGroupSummary, len(summaries))
+	for group, summary := range summaries {
+		names := notReady[group]
+		sort.Strings(names)
+		if len(names) > maxListedComponents {
+			names = names[:maxListedComponents]
+		}
+		summary.NotReadyNodes = names
+		result[group] = *summary
+	}
+	return result
+}
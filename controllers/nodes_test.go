@@ -0,0 +1,191 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testNode returns a ready node with labels and taints
+func testNode(name string, labels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	node := &corev1.Node{}
+	node.Name = name
+	node.Labels = labels
+	node.Spec.Taints = taints
+	node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	return node
+}
+
+func TestMatchNodeSelector(t *testing.T) {
+	node := testNode("cmp-1", map[string]string{"openstack-compute-node": "enabled", "cpus": "64"})
+	term := func(expressions ...corev1.NodeSelectorRequirement) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{MatchExpressions: expressions}
+	}
+	compute := corev1.NodeSelectorRequirement{Key: "openstack-compute-node", Operator: corev1.NodeSelectorOpIn, Values: []string{"enabled"}}
+	control := corev1.NodeSelectorRequirement{Key: "openstack-control-plane", Operator: corev1.NodeSelectorOpExists}
+	tests := []struct {
+		name    string
+		terms   []corev1.NodeSelectorTerm
+		matches bool
+	}{
+		{name: "no terms"},
+		{name: "empty term", terms: []corev1.NodeSelectorTerm{{}}},
+		{name: "in", terms: []corev1.NodeSelectorTerm{term(compute)}, matches: true},
+		{name: "all expressions of a term", terms: []corev1.NodeSelectorTerm{term(compute, control)}},
+		{name: "any term", terms: []corev1.NodeSelectorTerm{term(control), term(compute)}, matches: true},
+		{
+			name:    "does not exist",
+			terms:   []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "openstack-control-plane", Operator: corev1.NodeSelectorOpDoesNotExist})},
+			matches: true,
+		},
+		{
+			name:    "greater than",
+			terms:   []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "cpus", Operator: corev1.NodeSelectorOpGt, Values: []string{"32"}})},
+			matches: true,
+		},
+		{
+			name:  "less than",
+			terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "cpus", Operator: corev1.NodeSelectorOpLt, Values: []string{"32"}})},
+		},
+		{
+			name:  "unknown operator",
+			terms: []corev1.NodeSelectorTerm{term(corev1.NodeSelectorRequirement{Key: "cpus", Operator: "Like", Values: []string{"6*"}})},
+		},
+		{
+			name:    "field selectors match",
+			terms:   []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"cmp-2"}}}}},
+			matches: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := matchNodeSelector(node, &corev1.NodeSelector{NodeSelectorTerms: test.terms}); matches != test.matches {
+				t.Errorf("matches %v, want %v", matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestNodeRunsPod(t *testing.T) {
+	computeLabels := map[string]string{"openstack-compute-node": "enabled"}
+	dedicated := corev1.Taint{Key: "dedicated", Value: "ceph", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name string
+		node *corev1.Node
+		spec corev1.PodSpec
+		runs bool
+	}{
+		{name: "any node", node: testNode("a", nil), runs: true},
+		{name: "node selector", node: testNode("a", computeLabels), spec: corev1.PodSpec{NodeSelector: computeLabels}, runs: true},
+		{name: "node selector mismatch", node: testNode("a", nil), spec: corev1.PodSpec{NodeSelector: computeLabels}},
+		{
+			name: "required node affinity",
+			node: testNode("a", nil),
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "openstack-compute-node", Operator: corev1.NodeSelectorOpExists}},
+				}}},
+			}}},
+		},
+		{name: "untolerated taint", node: testNode("a", nil, dedicated)},
+		{
+			name: "tolerated taint",
+			node: testNode("a", nil, dedicated),
+			spec: corev1.PodSpec{Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ceph"}}},
+			runs: true,
+		},
+		{
+			name: "prefer no schedule",
+			node: testNode("a", nil, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectPreferNoSchedule}),
+			runs: true,
+		},
+		{
+			name: "taints tolerated by every daemon",
+			node: testNode("a", nil,
+				corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule},
+				corev1.Taint{Key: corev1.TaintNodeNotReady, Effect: corev1.TaintEffectNoExecute}),
+			runs: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if runs := nodeRunsPod(test.node, &test.spec); runs != test.runs {
+				t.Errorf("runs %v, want %v", runs, test.runs)
+			}
+		})
+	}
+}
+
+func TestSummarizeNodes(t *testing.T) {
+	compute := map[string]string{"node-role": "compute"}
+	control := map[string]string{"node-role": "control"}
+	notReady := testNode("cmp-2", compute)
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	pressure := testNode("cmp-3", compute)
+	pressure.Status.Conditions = append(pressure.Status.Conditions,
+		corev1.NodeCondition{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue},
+		corev1.NodeCondition{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse})
+	cordoned := testNode("ctl-2", control, corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule})
+	cordoned.Spec.Unschedulable = true
+	unknown := testNode("ctl-3", control)
+	unknown.Status.Conditions = nil
+	nodes := []corev1.Node{
+		*testNode("cmp-1", compute),
+		*notReady,
+		*pressure,
+		*testNode("ctl-1", control),
+		*cordoned,
+		*unknown,
+		*testNode("spare", nil),
+	}
+
+	summaries := summarizeNodes(nodes, "node-role")
+	if len(summaries) != 3 {
+		t.Fatalf("groups %v, want compute, control and none", summaries)
+	}
+	want := map[string]struct {
+		status                          string
+		ready, notReady, cordoned, disk int32
+		memory                          int32
+		notReadyNodes                   []string
+	}{
+		"compute": {status: "notready", ready: 2, notReady: 1, memory: 1, notReadyNodes: []string{"cmp-2", "cmp-3"}},
+		"control": {status: "notready", ready: 2, notReady: 1, cordoned: 1, notReadyNodes: []string{"ctl-3"}},
+		"none":    {status: "ready", ready: 1},
+	}
+	for group, w := range want {
+		s := summaries[group]
+		if s.Status != w.status || s.Ready != w.ready || s.NotReady != w.notReady || s.Cordoned != w.cordoned ||
+			s.MemoryPressure != w.memory || s.DiskPressure != w.disk {
+			t.Errorf("%s: summary %+v, want %+v", group, s, w)
+		}
+		if !reflect.DeepEqual(s.NotReadyNodes, w.notReadyNodes) {
+			t.Errorf("%s: not ready nodes %v, want %v", group, s.NotReadyNodes, w.notReadyNodes)
+		}
+	}
+	if taints := summaries["control"].Taints; !reflect.DeepEqual(taints, map[string]int32{corev1.TaintNodeUnschedulable + ":NoSchedule": 1}) {
+		t.Errorf("taints %v", taints)
+	}
+
+	all := summarizeNodes(nodes, "")
+	if len(all) != 1 || all["all"].Ready != 5 || all["all"].NotReady != 2 {
+		t.Errorf("summary without a label %+v, want all nodes in one group", all)
+	}
+}
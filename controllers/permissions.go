@@ -0,0 +1,177 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// ConditionPermissionsGranted reports whether the operator is allowed to
+// read every configured kind in the namespace of a Health
+const ConditionPermissionsGranted = "PermissionsGranted"
+
+// permissionCheckPeriod is how often permissions are checked again, so
+// that RBAC changes and new Health objects are picked up
+const permissionCheckPeriod = 10 * time.Minute
+
+// Permission is a set of verbs on a resource the operator relies on
+type Permission struct {
+	Group       string
+	Resource    string
+	Subresource string
+	Verbs       []string
+}
+
+// ReadPermission is the permission needed to watch a resource
+func ReadPermission(group, resource string) Permission {
+	return Permission{Group: group, Resource: resource, Verbs: []string{"get", "list", "watch"}}
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	if p.Group != "" {
+		resource = p.Group + "/" + resource
+	}
+	return resource
+}
+
+// PermissionChecker verifies with SelfSubjectAccessReviews that the operator
+// holds the configured permissions and reports missing ones as the
+// PermissionsGranted condition of every Health. Creating
+// SelfSubjectAccessReviews is allowed for every authenticated user.
+type PermissionChecker struct {
+	client.Client
+	Log logr.Logger
+	// Namespaces the operator is restricted to, empty for cluster wide access
+	Namespaces  []string
+	Permissions []Permission
+}
+
+// Start implements manager.Runnable
+func (c *PermissionChecker) Start(stop <-chan struct{}) error {
+	wait.Until(c.check, permissionCheckPeriod, stop)
+	return nil
+}
+
+func (c *PermissionChecker) check() {
+	ctx := context.Background()
+	namespaces := c.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	missing := map[string][]string{}
+	for _, namespace := range namespaces {
+		for _, permission := range c.Permissions {
+			for _, verb := range permission.Verbs {
+				allowed, err := c.allowed(ctx, namespace, verb, permission)
+				if err != nil {
+					c.Log.Error(err, "Failed to review access", "namespace", namespace, "verb", verb, "resource", permission.String())
+					continue
+				}
+				if !allowed {
+					missing[namespace] = append(missing[namespace], verb+" "+permission.String())
+				}
+			}
+		}
+	}
+	for namespace, denied := range missing {
+		c.Log.Info("Missing permissions", "namespace", namespace, "denied", denied)
+	}
+
+	healths := &commonv1alpha1.HealthList{}
+	err := c.List(ctx, healths)
+	if err != nil {
+		c.Log.Error(err, "Failed to list Health")
+		return
+	}
+	for i := range healths.Items {
+		health := &healths.Items[i]
+		denied := append(missing[metav1.NamespaceAll], missing[health.Namespace]...)
+		condition := commonv1alpha1.Condition{
+			Type:               ConditionPermissionsGranted,
+			Status:             metav1.ConditionTrue,
+			Reason:             "AllPermissionsGranted",
+			Message:            "The operator can read all configured kinds",
+			LastTransitionTime: metav1.Now(),
+		}
+		if len(denied) > 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "MissingPermissions"
+			condition.Message = "Missing permissions: " + strings.Join(denied, ", ")
+		}
+		err := c.setCondition(ctx, health, condition)
+		if err != nil {
+			c.Log.Error(err, "Failed to update Health status", "health", fmt.Sprintf("%s/%s", health.Namespace, health.Name))
+		}
+	}
+}
+
+func (c *PermissionChecker) allowed(ctx context.Context, namespace, verb string, permission Permission) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       permission.Group,
+				Resource:    permission.Resource,
+				Subresource: permission.Subresource,
+			},
+		},
+	}
+	err := c.Create(ctx, review)
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// setCondition updates a condition of health, retrying on conflicts with
+// the reconcilers patching component statuses.
+func (c *PermissionChecker) setCondition(ctx context.Context, health *commonv1alpha1.Health, condition commonv1alpha1.Condition) error {
+	key := client.ObjectKey{Namespace: health.Namespace, Name: health.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := c.Get(ctx, key, health)
+		if err != nil {
+			return err
+		}
+		existing := commonv1alpha1.FindCondition(health.Status.Conditions, condition.Type)
+		if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message {
+			return nil
+		}
+		// a merge patch leaves the components reported meanwhile untouched,
+		// the resource version makes concurrent condition changes conflict
+		original := health.DeepCopy()
+		commonv1alpha1.SetCondition(&health.Status.Conditions, condition)
+		return c.Status().Patch(ctx, health, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	})
+}
@@ -0,0 +1,163 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	// maxDiagnostics bounds the number of causes reported for a component
+	maxDiagnostics = 5
+	// maxDiagnosticMessage bounds the length of a diagnostic message
+	maxDiagnosticMessage = 256
+)
+
+// truncate shortens s to at most max bytes without splitting a character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// truncateStart keeps at most the last max bytes of s without splitting a
+// character
+func truncateStart(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	start := len(s) - max
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// ownedPods lists the pods matching selector which are controlled by one of owners
+func ownedPods(ctx context.Context, c client.Client, namespace string, selector *metav1.LabelSelector, owners map[types.UID]bool) ([]corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	err = c.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	var owned []corev1.Pod
+	for _, pod := range pods.Items {
+		if ref := metav1.GetControllerOf(&pod); ref != nil && owners[ref.UID] {
+			owned = append(owned, pod)
+		}
+	}
+	return owned, nil
+}
+
+// diagnosePods summarizes the most common causes of pods not being ready.
+// Causes are ordered by the number of affected pods.
+func diagnosePods(pods []corev1.Pod) []commonv1alpha1.PodDiagnostic {
+	byReason := map[string]*commonv1alpha1.PodDiagnostic{}
+	var reasons []string
+	add := func(reason, message string) {
+		diagnostic, ok := byReason[reason]
+		if !ok {
+			message = truncate(message, maxDiagnosticMessage)
+			diagnostic = &commonv1alpha1.PodDiagnostic{Reason: reason, Message: message}
+			byReason[reason] = diagnostic
+			reasons = append(reasons, reason)
+		}
+		diagnostic.Pods++
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		for _, reason := range diagnosePod(pod) {
+			add(reason[0], fmt.Sprintf("pod %s: %s", pod.Name, reason[1]))
+		}
+	}
+
+	sort.SliceStable(reasons, func(i, j int) bool {
+		return byReason[reasons[i]].Pods > byReason[reasons[j]].Pods
+	})
+	if len(reasons) > maxDiagnostics {
+		reasons = reasons[:maxDiagnostics]
+	}
+	diagnostics := make([]commonv1alpha1.PodDiagnostic, 0, len(reasons))
+	for _, reason := range reasons {
+		diagnostics = append(diagnostics, *byReason[reason])
+	}
+	return diagnostics
+}
+
+// diagnosePod returns reason and message pairs explaining why pod is not
+// ready, each reason is reported once per pod
+func diagnosePod(pod *corev1.Pod) [][2]string {
+	var found [][2]string
+	seen := map[string]bool{}
+	add := func(reason, message string) {
+		if !seen[reason] {
+			seen[reason] = true
+			found = append(found, [2]string{reason, message})
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodPending {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+				add("Unschedulable", c.Message)
+			}
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i, s := range statuses {
+		if waiting := s.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "CrashLoopBackOff":
+				add("CrashLoopBackOff", fmt.Sprintf("container %s restarted %d times", s.Name, s.RestartCount))
+			case "ImagePullBackOff", "ErrImagePull":
+				add("ImagePullBackOff", fmt.Sprintf("container %s cannot pull image %s", s.Name, s.Image))
+			}
+		}
+		if terminated := s.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			add("OOMKilled", fmt.Sprintf("container %s was killed for exceeding its memory limit", s.Name))
+		}
+		if terminated := s.State.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			add("OOMKilled", fmt.Sprintf("container %s was killed for exceeding its memory limit", s.Name))
+		}
+		// init containers have no readiness probes
+		isInit := i < len(pod.Status.InitContainerStatuses)
+		if !isInit && s.State.Running != nil && !s.Ready {
+			add("ReadinessProbeFailed", fmt.Sprintf("container %s is running but not ready", s.Name))
+		}
+	}
+	return found
+}
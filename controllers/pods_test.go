@@ -0,0 +1,157 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func waitingPod(name, reason string) corev1.Pod {
+	pod := corev1.Pod{}
+	pod.Name = name
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:         "api",
+		Image:        "docker.io/openstackhelm/nova:ussuri",
+		RestartCount: 7,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+	}}
+	return pod
+}
+
+func unschedulablePod(name string) corev1.Pod {
+	pod := corev1.Pod{}
+	pod.Name = name
+	pod.Status.Phase = corev1.PodPending
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "0/3 nodes are available: 3 Insufficient memory.",
+	}}
+	return pod
+}
+
+func TestDiagnosePods(t *testing.T) {
+	oomKilled := waitingPod("oom", "CrashLoopBackOff")
+	oomKilled.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "OOMKilled"}
+	notReady := waitingPod("probe", "")
+	notReady.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	initWaiting := unschedulablePod("init")
+	initWaiting.Status.Conditions = nil
+	initWaiting.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "init",
+		Image: "docker.io/openstackhelm/heat:ussuri",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}},
+	}}
+
+	tests := []struct {
+		name        string
+		pods        []corev1.Pod
+		diagnostics []commonv1alpha1.PodDiagnostic
+	}{
+		{
+			name: "healthy",
+			pods: []corev1.Pod{waitingPod("ok", "")},
+		},
+		{
+			name: "crash loop",
+			pods: []corev1.Pod{waitingPod("a", "CrashLoopBackOff")},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "CrashLoopBackOff", Pods: 1, Message: "pod a: container api restarted 7 times"},
+			},
+		},
+		{
+			name: "image pull",
+			pods: []corev1.Pod{waitingPod("a", "ImagePullBackOff"), waitingPod("b", "ErrImagePull")},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "ImagePullBackOff", Pods: 2, Message: "pod a: container api cannot pull image docker.io/openstackhelm/nova:ussuri"},
+			},
+		},
+		{
+			name: "init container image pull",
+			pods: []corev1.Pod{initWaiting},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "ImagePullBackOff", Pods: 1, Message: "pod init: container init cannot pull image docker.io/openstackhelm/heat:ussuri"},
+			},
+		},
+		{
+			name: "unschedulable",
+			pods: []corev1.Pod{unschedulablePod("a")},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "Unschedulable", Pods: 1, Message: "pod a: 0/3 nodes are available: 3 Insufficient memory."},
+			},
+		},
+		{
+			name: "out of memory",
+			pods: []corev1.Pod{oomKilled},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "CrashLoopBackOff", Pods: 1, Message: "pod oom: container api restarted 7 times"},
+				{Reason: "OOMKilled", Pods: 1, Message: "pod oom: container api was killed for exceeding its memory limit"},
+			},
+		},
+		{
+			name: "readiness probe",
+			pods: []corev1.Pod{notReady},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "ReadinessProbeFailed", Pods: 1, Message: "pod probe: container api is running but not ready"},
+			},
+		},
+		{
+			name: "ordered by affected pods",
+			pods: []corev1.Pod{unschedulablePod("a"), waitingPod("b", "CrashLoopBackOff"), waitingPod("c", "CrashLoopBackOff")},
+			diagnostics: []commonv1alpha1.PodDiagnostic{
+				{Reason: "CrashLoopBackOff", Pods: 2, Message: "pod b: container api restarted 7 times"},
+				{Reason: "Unschedulable", Pods: 1, Message: "pod a: 0/3 nodes are available: 3 Insufficient memory."},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics := diagnosePods(test.pods)
+			if len(diagnostics) == 0 && len(test.diagnostics) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(diagnostics, test.diagnostics) {
+				t.Errorf("diagnostics %+v, want %+v", diagnostics, test.diagnostics)
+			}
+		})
+	}
+}
+
+func TestDiagnosePodsMessageLength(t *testing.T) {
+	pod := unschedulablePod("a")
+	pod.Status.Conditions[0].Message = strings.Repeat("ü", maxDiagnosticMessage)
+	diagnostics := diagnosePods([]corev1.Pod{pod})
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics %+v, want one", diagnostics)
+	}
+	message := diagnostics[0].Message
+	if len(message) > maxDiagnosticMessage || !strings.HasPrefix(message, "pod a: ") {
+		t.Errorf("message of %d bytes, at most %d are kept", len(message), maxDiagnosticMessage)
+	}
+	if !utf8.ValidString(message) {
+		t.Error("message truncated within a character")
+	}
+}
@@ -0,0 +1,212 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// maxProbeBody bounds the part of an HTTP response body matched by BodyRegex
+const maxProbeBody = 1 << 20
+
+// probeResult is the outcome of a probe, reason is empty on success
+type probeResult struct {
+	reason  string
+	message string
+	latency time.Duration
+}
+
+// serviceAddress is the host:port of a Service port in namespace
+func serviceAddress(service, namespace string, port int32) string {
+	return net.JoinHostPort(fmt.Sprintf("%s.%s.svc", service, namespace), fmt.Sprint(port))
+}
+
+// validService reports why service is not a Service name, so that probes
+// never reach other hosts than the Services of their namespace
+func validService(service string) error {
+	if errs := validation.IsDNS1035Label(service); len(errs) > 0 {
+		return fmt.Errorf("invalid Service name %q: %s", service, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// runProbe runs the probe configured in spec against Services of namespace
+func runProbe(ctx context.Context, spec *commonv1alpha1.HealthCheckSpec, namespace string) probeResult {
+	var service string
+	switch {
+	case spec.HTTP != nil:
+		service = spec.HTTP.Service
+	case spec.TCP != nil:
+		service = spec.TCP.Service
+	case spec.GRPC != nil:
+		service = spec.GRPC.Service
+	}
+	if err := validService(service); err != nil {
+		return probeResult{reason: "InvalidSpec", message: err.Error()}
+	}
+
+	start := time.Now()
+	var result probeResult
+	switch {
+	case spec.HTTP != nil:
+		result = probeHTTP(ctx, spec.HTTP, namespace)
+	case spec.TCP != nil:
+		result = probeTCP(ctx, spec.TCP, namespace)
+	case spec.GRPC != nil:
+		result = probeGRPC(ctx, spec.GRPC, namespace)
+	default:
+		return probeResult{reason: "InvalidSpec", message: "one of http, tcp or grpc must be set"}
+	}
+	result.latency = time.Since(start)
+	return result
+}
+
+// probeURL returns the URL requested by probe. The host is always the
+// Service, the path may only carry a query.
+func probeURL(probe *commonv1alpha1.HTTPProbe, namespace string) (*url.URL, error) {
+	scheme := probe.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", scheme)
+	}
+	path, query := probe.Path, ""
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path %q does not start with /", path)
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     serviceAddress(probe.Service, namespace, probe.Port),
+		Path:     path,
+		RawQuery: query,
+	}, nil
+}
+
+func probeHTTP(ctx context.Context, probe *commonv1alpha1.HTTPProbe, namespace string) probeResult {
+	var bodyRegex *regexp.Regexp
+	if probe.BodyRegex != "" {
+		var err error
+		bodyRegex, err = regexp.Compile(probe.BodyRegex)
+		if err != nil {
+			return probeResult{reason: "InvalidSpec", message: err.Error()}
+		}
+	}
+	target, err := probeURL(probe, namespace)
+	if err != nil {
+		return probeResult{reason: "InvalidSpec", message: err.Error()}
+	}
+	url := target.String()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return probeResult{reason: "InvalidSpec", message: err.Error()}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// probes check availability, not the certificates of Services
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return probeResult{reason: "RequestFailed", message: err.Error()}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return probeResult{reason: "RequestFailed", message: err.Error()}
+	}
+	latency := time.Since(start)
+
+	if !expectedStatusCode(probe.ExpectedStatusCodes, resp.StatusCode) {
+		return probeResult{reason: "UnexpectedStatusCode", message: fmt.Sprintf("GET %s returned %d", url, resp.StatusCode)}
+	}
+	if bodyRegex != nil && !bodyRegex.Match(body) {
+		return probeResult{reason: "BodyMismatch", message: fmt.Sprintf("response body of GET %s does not match %q", url, probe.BodyRegex)}
+	}
+	if probe.LatencyBudget != nil && latency > probe.LatencyBudget.Duration {
+		return probeResult{reason: "LatencyBudgetExceeded", message: fmt.Sprintf("GET %s took %s, budget %s", url, latency.Round(time.Millisecond), probe.LatencyBudget.Duration)}
+	}
+	return probeResult{}
+}
+
+// expectedStatusCode reports whether code is one of expected, or a 2xx or
+// 3xx code when expected is empty
+func expectedStatusCode(expected []int32, code int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, e := range expected {
+		if int(e) == code {
+			return true
+		}
+	}
+	return false
+}
+
+func probeTCP(ctx context.Context, probe *commonv1alpha1.TCPProbe, namespace string) probeResult {
+	address := serviceAddress(probe.Service, namespace, probe.Port)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return probeResult{reason: "ConnectFailed", message: err.Error()}
+	}
+	conn.Close()
+	return probeResult{}
+}
+
+func probeGRPC(ctx context.Context, probe *commonv1alpha1.GRPCProbe, namespace string) probeResult {
+	address := serviceAddress(probe.Service, namespace, probe.Port)
+	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return probeResult{reason: "ConnectFailed", message: fmt.Sprintf("connecting to %s: %v", address, err)}
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: probe.HealthService})
+	if err != nil {
+		return probeResult{reason: "RequestFailed", message: err.Error()}
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return probeResult{reason: "NotServing", message: fmt.Sprintf("%s reports %s", address, resp.Status)}
+	}
+	return probeResult{}
+}
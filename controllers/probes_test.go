@@ -0,0 +1,95 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestProbeURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe commonv1alpha1.HTTPProbe
+		url   string
+		err   bool
+	}{
+		{
+			name:  "default path",
+			probe: commonv1alpha1.HTTPProbe{Service: "api", Port: 8080},
+			url:   "http://api.openstack.svc:8080/",
+		},
+		{
+			name:  "path with query",
+			probe: commonv1alpha1.HTTPProbe{Service: "api", Port: 443, Scheme: "https", Path: "/healthz?verbose=1"},
+			url:   "https://api.openstack.svc:443/healthz?verbose=1",
+		},
+		{
+			name:  "userinfo in the path",
+			probe: commonv1alpha1.HTTPProbe{Service: "api", Port: 80, Path: "@169.254.169.254/latest"},
+			err:   true,
+		},
+		{
+			name:  "host in the path",
+			probe: commonv1alpha1.HTTPProbe{Service: "api", Port: 80, Path: "//169.254.169.254/latest"},
+			url:   "http://api.openstack.svc:80//169.254.169.254/latest",
+		},
+		{
+			name:  "unsupported scheme",
+			probe: commonv1alpha1.HTTPProbe{Service: "api", Port: 80, Scheme: "file"},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := probeURL(&test.probe, "openstack")
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if target.String() != test.url {
+				t.Errorf("url %s, want %s", target, test.url)
+			}
+			parsed, err := url.Parse(target.String())
+			if err != nil || parsed.Hostname() != "api.openstack.svc" {
+				t.Errorf("url %s does not request the Service", target)
+			}
+		})
+	}
+}
+
+func TestRunProbeInvalidService(t *testing.T) {
+	services := []string{"169.254.169.254/latest/meta-data?x=", "api.other", "Api", ""}
+	for _, service := range services {
+		specs := []commonv1alpha1.HealthCheckSpec{
+			{HTTP: &commonv1alpha1.HTTPProbe{Service: service, Port: 80}},
+			{TCP: &commonv1alpha1.TCPProbe{Service: service, Port: 80}},
+			{GRPC: &commonv1alpha1.GRPCProbe{Service: service, Port: 80}},
+		}
+		for i := range specs {
+			result := runProbe(context.Background(), &specs[i], "openstack")
+			if result.reason != "InvalidSpec" {
+				t.Errorf("service %q probed with reason %q", service, result.reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// maxPrometheusResponse bounds the size of a query response read
+const maxPrometheusResponse = 10 << 20
+
+// prometheusResponse is the envelope of the Prometheus HTTP API
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// prometheusSample is a [timestamp, "value"] pair
+type prometheusSample [2]interface{}
+
+func (s prometheusSample) value() (float64, error) {
+	value, ok := s[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample value %v", s[1])
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// prometheusError is returned when Prometheus answers but rejects a query
+type prometheusError struct {
+	errorType string
+	message   string
+}
+
+func (e *prometheusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.errorType, e.message)
+}
+
+// queryPrometheus evaluates an instant query against the Prometheus server
+// at baseURL and returns the values of the resulting samples
+func queryPrometheus(ctx context.Context, client *http.Client, baseURL, query string) ([]float64, error) {
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPrometheusResponse))
+	if err != nil {
+		return nil, err
+	}
+
+	response := prometheusResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("unexpected response with status %d: %v", resp.StatusCode, err)
+	}
+	if response.Status != "success" {
+		// server side failures are not the fault of the query
+		if resp.StatusCode >= 500 && response.ErrorType != "execution" {
+			return nil, fmt.Errorf("%s: %s", response.ErrorType, response.Error)
+		}
+		return nil, &prometheusError{errorType: response.ErrorType, message: response.Error}
+	}
+
+	var values []float64
+	switch response.Data.ResultType {
+	case "scalar":
+		var sample prometheusSample
+		if err := json.Unmarshal(response.Data.Result, &sample); err != nil {
+			return nil, err
+		}
+		value, err := sample.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	case "vector":
+		var vector []struct {
+			Value prometheusSample `json:"value"`
+		}
+		if err := json.Unmarshal(response.Data.Result, &vector); err != nil {
+			return nil, err
+		}
+		for _, sample := range vector {
+			value, err := sample.Value.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+	default:
+		return nil, &prometheusError{errorType: "bad_data", message: fmt.Sprintf("unsupported result type %q", response.Data.ResultType)}
+	}
+	return values, nil
+}
+
+// parseThreshold parses an optional threshold of a query
+func parseThreshold(threshold string) (*float64, error) {
+	if threshold == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold %q", threshold)
+	}
+	return &value, nil
+}
+
+// evaluateQuery runs query against the Prometheus server at baseURL and
+// maps its value to the status of a component. The status is unknown when
+// the value cannot be determined.
+func evaluateQuery(ctx context.Context, client *http.Client, baseURL string, query commonv1alpha1.PrometheusQuery) commonv1alpha1.ComponentStatus {
+	status := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusUnknown, Reason: "InvalidSpec"}
+	degraded, err := parseThreshold(query.Degraded)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	down, err := parseThreshold(query.Down)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	if baseURL == "" {
+		status.Message = "no Prometheus URL is configured"
+		return status
+	}
+
+	values, err := queryPrometheus(ctx, client, baseURL, query.Query)
+	if err != nil {
+		status.Reason = "PrometheusUnreachable"
+		if _, ok := err.(*prometheusError); ok {
+			status.Reason = "QueryFailed"
+		}
+		status.Message = truncate(err.Error(), maxDiagnosticMessage)
+		return status
+	}
+
+	status.Status = commonv1alpha1.StatusReady
+	status.Reason = ""
+	if len(values) == 0 {
+		status.Message = "query returned no samples"
+		return status
+	}
+	// reached reports whether value is at or beyond threshold
+	reached := func(value float64, threshold *float64) bool {
+		if threshold == nil {
+			return false
+		}
+		if query.Below {
+			return value <= *threshold
+		}
+		return value >= *threshold
+	}
+	worst := values[0]
+	for _, value := range values[1:] {
+		if reached(value, &worst) {
+			worst = value
+		}
+	}
+	value := strconv.FormatFloat(worst, 'g', -1, 64)
+	status.Message = "value " + value
+	switch {
+	case reached(worst, down):
+		status.Status = commonv1alpha1.StatusDown
+		status.Reason = "DownThresholdReached"
+		status.Message = fmt.Sprintf("value %s reached the down threshold %s", value, query.Down)
+	case reached(worst, degraded):
+		status.Status = commonv1alpha1.StatusDegraded
+		status.Reason = "DegradedThresholdReached"
+		status.Message = fmt.Sprintf("value %s reached the degraded threshold %s", value, query.Degraded)
+	}
+	return status
+}
@@ -0,0 +1,196 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// fakePrometheus serves body with code for every query
+func fakePrometheus(t *testing.T, code int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("query") == "" {
+			t.Errorf("missing query")
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+}
+
+const (
+	vectorResponse = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"instance":"a"},"value":[1598918400,"0.5"]},
+		{"metric":{"instance":"b"},"value":[1598918400,"3"]}]}}`
+	scalarResponse = `{"status":"success","data":{"resultType":"scalar","result":[1598918400,"7"]}}`
+	emptyResponse  = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+	badQuery       = `{"status":"error","errorType":"bad_data","error":"parse error"}`
+)
+
+func TestQueryPrometheus(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		body     string
+		values   []float64
+		err      bool
+		rejected bool
+	}{
+		{name: "vector", code: http.StatusOK, body: vectorResponse, values: []float64{0.5, 3}},
+		{name: "scalar", code: http.StatusOK, body: scalarResponse, values: []float64{7}},
+		{name: "empty", code: http.StatusOK, body: emptyResponse},
+		{name: "rejected query", code: http.StatusBadRequest, body: badQuery, err: true, rejected: true},
+		{name: "server error", code: http.StatusBadGateway, body: "bad gateway", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakePrometheus(t, test.code, test.body)
+			defer server.Close()
+
+			values, err := queryPrometheus(context.Background(), server.Client(), server.URL+"/", "up")
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if _, ok := err.(*prometheusError); ok != test.rejected {
+				t.Errorf("error %v rejected %v, want %v", err, ok, test.rejected)
+			}
+			if len(values) != len(test.values) {
+				t.Fatalf("values %v, want %v", values, test.values)
+			}
+			for i := range values {
+				if values[i] != test.values[i] {
+					t.Errorf("values %v, want %v", values, test.values)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		body   string
+		query  commonv1alpha1.PrometheusQuery
+		status string
+		reason string
+	}{
+		{
+			name:   "below thresholds",
+			code:   http.StatusOK,
+			body:   scalarResponse,
+			query:  commonv1alpha1.PrometheusQuery{Degraded: "10", Down: "20"},
+			status: commonv1alpha1.StatusReady,
+		},
+		{
+			name:   "degraded threshold",
+			code:   http.StatusOK,
+			body:   scalarResponse,
+			query:  commonv1alpha1.PrometheusQuery{Degraded: "7", Down: "20"},
+			status: commonv1alpha1.StatusDegraded,
+			reason: "DegradedThresholdReached",
+		},
+		{
+			name:   "worst sample reaches down threshold",
+			code:   http.StatusOK,
+			body:   vectorResponse,
+			query:  commonv1alpha1.PrometheusQuery{Degraded: "1", Down: "2"},
+			status: commonv1alpha1.StatusDown,
+			reason: "DownThresholdReached",
+		},
+		{
+			name:   "below thresholds with below",
+			code:   http.StatusOK,
+			body:   vectorResponse,
+			query:  commonv1alpha1.PrometheusQuery{Degraded: "1", Down: "0.1", Below: true},
+			status: commonv1alpha1.StatusDegraded,
+			reason: "DegradedThresholdReached",
+		},
+		{
+			name:   "no samples",
+			code:   http.StatusOK,
+			body:   emptyResponse,
+			query:  commonv1alpha1.PrometheusQuery{Down: "1"},
+			status: commonv1alpha1.StatusReady,
+		},
+		{
+			name:   "rejected query",
+			code:   http.StatusBadRequest,
+			body:   badQuery,
+			query:  commonv1alpha1.PrometheusQuery{Down: "1"},
+			status: commonv1alpha1.StatusUnknown,
+			reason: "QueryFailed",
+		},
+		{
+			name:   "server error",
+			code:   http.StatusInternalServerError,
+			body:   "internal error",
+			query:  commonv1alpha1.PrometheusQuery{Down: "1"},
+			status: commonv1alpha1.StatusUnknown,
+			reason: "PrometheusUnreachable",
+		},
+		{
+			name:   "invalid threshold",
+			code:   http.StatusOK,
+			body:   scalarResponse,
+			query:  commonv1alpha1.PrometheusQuery{Down: "many"},
+			status: commonv1alpha1.StatusUnknown,
+			reason: "InvalidSpec",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakePrometheus(t, test.code, test.body)
+			defer server.Close()
+
+			test.query.Query = "up"
+			status := evaluateQuery(context.Background(), server.Client(), server.URL, test.query)
+			if status.Status != test.status || status.Reason != test.reason {
+				t.Errorf("status %s reason %s (%s), want %s reason %s",
+					status.Status, status.Reason, status.Message, test.status, test.reason)
+			}
+		})
+	}
+}
+
+func TestPrometheusURL(t *testing.T) {
+	r := &PrometheusHealthReconciler{URL: "http://prometheus.monitoring:9090", AllowedURLs: []string{"http://thanos.monitoring:9090"}}
+	tests := []struct {
+		url     string
+		want    string
+		allowed bool
+	}{
+		{url: "", want: "http://prometheus.monitoring:9090", allowed: true},
+		{url: "http://prometheus.monitoring:9090", want: "http://prometheus.monitoring:9090", allowed: true},
+		{url: "http://thanos.monitoring:9090", want: "http://thanos.monitoring:9090", allowed: true},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "http://thanos.monitoring:9090.attacker.example"},
+	}
+	for _, test := range tests {
+		got, err := r.prometheusURL(&commonv1alpha1.PrometheusSpec{URL: test.url})
+		if got != test.want || (err == nil) != test.allowed {
+			t.Errorf("%q: URL %q with error %v, want %q allowed %v", test.url, got, err, test.want, test.allowed)
+		}
+	}
+}
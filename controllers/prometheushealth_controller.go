@@ -0,0 +1,164 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+const (
+	defaultPrometheusInterval = time.Minute
+	prometheusQueryTimeout    = 10 * time.Second
+)
+
+// PrometheusHealthReconciler evaluates the Prometheus queries in the spec of
+// a Health on an interval and reports their results as components
+type PrometheusHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// URL of the Prometheus server used when the spec has none
+	URL string
+	// AllowedURLs the spec may select besides URL. Any other URL is
+	// rejected, the operator would otherwise send requests from inside
+	// the cluster to any address a tenant chooses.
+	AllowedURLs []string
+	// HTTPClient used for queries, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+func (r *PrometheusHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("prometheushealth", req.NamespacedName)
+
+	if req.Name != "health" {
+		return ctrl.Result{}, nil
+	}
+
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, req.NamespacedName, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Health")
+		return ctrl.Result{}, err
+	}
+	// components of queries removed from the spec are removed
+	source := componentSource("Health", health.Name) + "/prometheus"
+	keep := map[string]bool{}
+	spec := health.Spec.Prometheus
+	if spec == nil || len(spec.Queries) == 0 {
+		err = removeComponentsOf(ctx, r.Client, health, source, keep)
+		if err != nil {
+			log.Error(err, "Failed to update Health status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	baseURL, urlErr := r.prometheusURL(spec)
+	if urlErr != nil {
+		log.Info("Rejecting Prometheus URL", "url", spec.URL)
+	}
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	interval := defaultPrometheusInterval
+	if spec.Interval != nil && spec.Interval.Duration > 0 {
+		interval = spec.Interval.Duration
+	}
+	for _, query := range spec.Queries {
+		parts := strings.SplitN(query.Component, "/", 2)
+		if len(parts) != 2 {
+			log.Info("Skipping query with invalid component", "component", query.Component)
+			continue
+		}
+		parts[0] = applicationName(parts[0])
+		status := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusUnknown, Reason: "InvalidSpec"}
+		if urlErr != nil {
+			status.Message = urlErr.Error()
+		} else {
+			queryCtx, cancel := context.WithTimeout(ctx, prometheusQueryTimeout)
+			status = evaluateQuery(queryCtx, httpClient, baseURL, query)
+			cancel()
+		}
+		status.Generation = health.Generation
+		status.Interval = &metav1.Duration{Duration: interval + prometheusQueryTimeout}
+		log.Info("Evaluated query", "component", query.Component, "status", status.Status, "reason", status.Reason)
+		// the next evaluation resolves a pending change
+		status, _ = applyHysteresis(health, parts[0], parts[1], status, time.Now())
+		status.Source = source
+		keep[parts[0]+"/"+parts[1]] = true
+
+		patch, err := getPatch(health, parts[0], parts[1], status)
+		if err != nil {
+			log.Error(err, "Failed to build Health status patch")
+			return ctrl.Result{}, err
+		}
+		err = patchHealthStatus(ctx, r.Client, health, patch)
+		if err != nil {
+			log.Error(err, "Failed to update Health status")
+			return ctrl.Result{}, err
+		}
+	}
+	err = removeComponentsOf(ctx, r.Client, health, source, keep)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// prometheusURL returns the URL of the Prometheus server queried for spec,
+// URL unless the spec selects one of AllowedURLs
+func (r *PrometheusHealthReconciler) prometheusURL(spec *commonv1alpha1.PrometheusSpec) (string, error) {
+	if spec.URL == "" || spec.URL == r.URL {
+		return r.URL, nil
+	}
+	for _, allowed := range r.AllowedURLs {
+		if spec.URL == allowed {
+			return spec.URL, nil
+		}
+	}
+	return "", fmt.Errorf("Prometheus URL %s is not allowed by the --prometheus-urls flag of the operator", spec.URL)
+}
+
+func (r *PrometheusHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// status updates are ignored, queries are evaluated on their interval
+	// and when the spec changes
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("prometheushealth").
+		For(&commonv1alpha1.Health{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
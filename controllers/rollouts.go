@@ -0,0 +1,185 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// templateImages returns the images of the containers of a pod template
+func templateImages(template *corev1.PodTemplateSpec) []string {
+	var images []string
+	for _, container := range template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// trackRollout returns the rollout of a component to report for the
+// observed one, given the rollout stored in health. A new revision or new
+// images start a rollout, which finishes once done reports the expected
+// pods updated and available. Generations changed by scaling only are not
+// rollouts. A rollout in progress keeps going when only the revision
+// changes, as the revision of a Deployment is only known once the
+// Deployment controller created its ReplicaSet.
+func trackRollout(health *commonv1alpha1.Health, app, component string, observed commonv1alpha1.Rollout, done bool, now time.Time) *commonv1alpha1.Rollout {
+	previous := health.Status.Applications[app][component].Rollout
+	rollout := observed
+	inProgress := previous != nil && previous.Started != nil && previous.Finished == nil
+	switch {
+	case previous != nil && equalStrings(previous.Images, observed.Images) &&
+		(previous.Revision == observed.Revision || inProgress):
+		rollout.Started = previous.Started
+		rollout.Finished = previous.Finished
+		rollout.Duration = previous.Duration
+	case previous != nil || !done:
+		rollout.Started = &metav1.Time{Time: now}
+	}
+	if done && rollout.Started != nil && rollout.Finished == nil {
+		rollout.Finished = &metav1.Time{Time: now}
+		rollout.Duration = now.Sub(rollout.Started.Time).Round(time.Second).String()
+	}
+	return &rollout
+}
+
+// equalStrings reports whether a and b hold the same strings in order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deploymentRevision returns the pod template hash of the ReplicaSet of the
+// current revision of obj, empty until the Deployment controller created it
+func deploymentRevision(ctx context.Context, c client.Client, obj *appsv1.Deployment) (string, error) {
+	revision, ok := obj.Annotations["deployment.kubernetes.io/revision"]
+	if !ok {
+		return "", nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return "", err
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	err = c.List(ctx, replicaSets, client.InNamespace(obj.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", err
+	}
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if ref := metav1.GetControllerOf(replicaSet); ref == nil || ref.UID != obj.UID {
+			continue
+		}
+		if replicaSet.Annotations["deployment.kubernetes.io/revision"] == revision {
+			return replicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey], nil
+		}
+	}
+	return "", nil
+}
+
+// deploymentRolledOut reports whether all replicas of obj run the pod
+// template of its generation and are available
+func deploymentRolledOut(obj *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	return obj.Status.ObservedGeneration >= obj.Generation &&
+		obj.Status.UpdatedReplicas == replicas &&
+		obj.Status.Replicas == replicas &&
+		obj.Status.AvailableReplicas == replicas
+}
+
+// statefulSetRolledOut reports whether the replicas of obj expected to run
+// the update revision do and all replicas are ready. With a partition only
+// the pods from the partition on are expected to be updated, with the
+// OnDelete strategy none are.
+func statefulSetRolledOut(obj *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	expected := replicas
+	strategy := obj.Spec.UpdateStrategy
+	switch {
+	case strategy.Type == appsv1.OnDeleteStatefulSetStrategyType:
+		expected = 0
+	case strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil && *strategy.RollingUpdate.Partition > 0:
+		expected = replicas - *strategy.RollingUpdate.Partition
+		if expected < 0 {
+			expected = 0
+		}
+	}
+	return obj.Status.ObservedGeneration >= obj.Generation &&
+		obj.Status.UpdatedReplicas >= expected &&
+		obj.Status.Replicas == replicas &&
+		obj.Status.ReadyReplicas == replicas
+}
+
+// daemonSetRevision returns the hash of the newest controller revision of
+// obj, empty until the DaemonSet controller created one
+func daemonSetRevision(ctx context.Context, c client.Client, obj *appsv1.DaemonSet) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Selector)
+	if err != nil {
+		return "", err
+	}
+	revisions := &appsv1.ControllerRevisionList{}
+	err = c.List(ctx, revisions, client.InNamespace(obj.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", err
+	}
+	var newest *appsv1.ControllerRevision
+	for i := range revisions.Items {
+		revision := &revisions.Items[i]
+		if ref := metav1.GetControllerOf(revision); ref == nil || ref.UID != obj.UID {
+			continue
+		}
+		if newest == nil || revision.Revision > newest.Revision {
+			newest = revision
+		}
+	}
+	if newest == nil {
+		return "", nil
+	}
+	if hash, ok := newest.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]; ok {
+		return hash, nil
+	}
+	return strconv.FormatInt(newest.Revision, 10), nil
+}
+
+// daemonSetRolledOut reports whether all scheduled pods of obj run the pod
+// template of its generation and are available
+func daemonSetRolledOut(obj *appsv1.DaemonSet) bool {
+	return obj.Status.ObservedGeneration >= obj.Generation &&
+		obj.Status.UpdatedNumberScheduled == obj.Status.DesiredNumberScheduled &&
+		obj.Status.NumberAvailable == obj.Status.DesiredNumberScheduled
+}
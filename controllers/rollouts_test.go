@@ -0,0 +1,160 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestTrackRollout(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	started := &metav1.Time{Time: now.Add(-5 * time.Minute)}
+	finished := &metav1.Time{Time: now.Add(-time.Minute)}
+	v1 := []string{"nova:v1"}
+	v2 := []string{"nova:v2"}
+
+	tests := []struct {
+		name     string
+		previous *commonv1alpha1.Rollout
+		observed commonv1alpha1.Rollout
+		done     bool
+		started  *metav1.Time
+		finished *metav1.Time
+		duration string
+	}{
+		{
+			name:     "first seen rolled out",
+			observed: commonv1alpha1.Rollout{Revision: "a", Images: v1},
+			done:     true,
+		},
+		{
+			name:     "first seen in progress",
+			observed: commonv1alpha1.Rollout{Revision: "a", Images: v1},
+			started:  &metav1.Time{Time: now},
+		},
+		{
+			name:     "new revision",
+			previous: &commonv1alpha1.Rollout{Revision: "a", Images: v1, Started: started, Finished: finished, Duration: "4m0s"},
+			observed: commonv1alpha1.Rollout{Revision: "b", Images: v1},
+			started:  &metav1.Time{Time: now},
+		},
+		{
+			name:     "new images",
+			previous: &commonv1alpha1.Rollout{Revision: "a", Images: v1},
+			observed: commonv1alpha1.Rollout{Revision: "a", Images: v2},
+			started:  &metav1.Time{Time: now},
+		},
+		{
+			name:     "finishes",
+			previous: &commonv1alpha1.Rollout{Images: v2, Started: started},
+			observed: commonv1alpha1.Rollout{Images: v2},
+			done:     true,
+			started:  started,
+			finished: &metav1.Time{Time: now},
+			duration: "5m0s",
+		},
+		{
+			name:     "revision known after the start",
+			previous: &commonv1alpha1.Rollout{Images: v2, Started: started},
+			observed: commonv1alpha1.Rollout{Revision: "b", Images: v2},
+			started:  started,
+		},
+		{
+			name:     "finished rollout is kept",
+			previous: &commonv1alpha1.Rollout{Generation: 2, Revision: "a", Images: v1, Started: started, Finished: finished, Duration: "4m0s"},
+			observed: commonv1alpha1.Rollout{Generation: 3, Revision: "a", Images: v1},
+			done:     true,
+			started:  started,
+			finished: finished,
+			duration: "4m0s",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			if test.previous != nil {
+				health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+					"nova": {"api": {Status: commonv1alpha1.StatusReady, Rollout: test.previous}},
+				}
+			}
+			rollout := trackRollout(health, "nova", "api", test.observed, test.done, now)
+			if rollout.Revision != test.observed.Revision || rollout.Generation != test.observed.Generation {
+				t.Errorf("rollout %+v does not report the observed one %+v", rollout, test.observed)
+			}
+			if !equalTimes(rollout.Started, test.started) || !equalTimes(rollout.Finished, test.finished) || rollout.Duration != test.duration {
+				t.Errorf("started %v finished %v duration %q, want %v %v %q",
+					rollout.Started, rollout.Finished, rollout.Duration, test.started, test.finished, test.duration)
+			}
+		})
+	}
+}
+
+// equalTimes reports whether two optional times are equal
+func equalTimes(a, b *metav1.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Time.Equal(b.Time)
+}
+
+func TestStatefulSetRolledOut(t *testing.T) {
+	int32Ptr := func(n int32) *int32 { return &n }
+	tests := []struct {
+		name      string
+		strategy  appsv1.StatefulSetUpdateStrategy
+		updated   int32
+		rolledOut bool
+	}{
+		{name: "all updated", updated: 3, rolledOut: true},
+		{name: "some updated", updated: 1},
+		{
+			name:      "pods from the partition on updated",
+			strategy:  appsv1.StatefulSetUpdateStrategy{RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(2)}},
+			updated:   1,
+			rolledOut: true,
+		},
+		{
+			name:     "partition not reached",
+			strategy: appsv1.StatefulSetUpdateStrategy{RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: int32Ptr(1)}},
+			updated:  1,
+		},
+		{
+			name:      "on delete",
+			strategy:  appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			rolledOut: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			obj := &appsv1.StatefulSet{}
+			obj.Spec.Replicas = int32Ptr(3)
+			obj.Spec.UpdateStrategy = test.strategy
+			obj.Status.Replicas = 3
+			obj.Status.ReadyReplicas = 3
+			obj.Status.UpdatedReplicas = test.updated
+			if rolledOut := statefulSetRolledOut(obj); rolledOut != test.rolledOut {
+				t.Errorf("rolled out %v, want %v", rolledOut, test.rolledOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// maxListedComponents bounds the number of components named in a summary
+const maxListedComponents = 10
+
+// summarizeHealth rolls up all components of a namespace Health
+func summarizeHealth(health *commonv1alpha1.Health) commonv1alpha1.NamespaceSummary {
+	summary := commonv1alpha1.NamespaceSummary{Status: rollupHealth(health).Status}
+	var notReady []string
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			if health.Spec.Healthy(status) || status.SilencedBy != "" {
+				summary.Ready++
+				continue
+			}
+			summary.NotReady++
+			notReady = append(notReady, app+"/"+component)
+		}
+	}
+	summary.NotReadyComponents = firstComponents(notReady)
+	return summary
+}
+
+// criticality returns the criticality of a component, configured for the
+// component, its application or normal
+func criticality(spec *commonv1alpha1.HealthSpec, app, component string) commonv1alpha1.Criticality {
+	if c, ok := spec.Criticality[app+"/"+component]; ok {
+		return c
+	}
+	if c, ok := spec.Criticality[app]; ok {
+		return c
+	}
+	return commonv1alpha1.CriticalityNormal
+}
+
+// rollupStatus returns "down" or "degraded" when an unhealthy component of
+// one of the criticalities configured for them is in unhealthy, "ready"
+// otherwise
+func rollupStatus(policy *commonv1alpha1.RollupPolicy, unhealthy map[commonv1alpha1.Criticality]bool) string {
+	down := policy.Down
+	if len(down) == 0 {
+		down = []commonv1alpha1.Criticality{commonv1alpha1.CriticalityCritical}
+	}
+	degraded := policy.Degraded
+	if len(degraded) == 0 {
+		degraded = []commonv1alpha1.Criticality{commonv1alpha1.CriticalityNormal}
+	}
+	for _, c := range down {
+		if unhealthy[c] {
+			return commonv1alpha1.StatusDown
+		}
+	}
+	for _, c := range degraded {
+		if unhealthy[c] {
+			return commonv1alpha1.StatusDegraded
+		}
+	}
+	return commonv1alpha1.StatusReady
+}
+
+// rollupHealth rolls up the components of health and of each of its
+// applications by their criticality, silenced components are left out.
+// Unknown components do not count as unhealthy, a rollup which they would
+// make down or degraded is unknown unless other components make it down or
+// degraded.
+func rollupHealth(health *commonv1alpha1.Health) *commonv1alpha1.RollupStatus {
+	spec := &health.Spec
+	rollup := &commonv1alpha1.RollupStatus{}
+	unhealthy := map[commonv1alpha1.Criticality]bool{}
+	unknown := map[commonv1alpha1.Criticality]bool{}
+	var down, degraded, unknownComponents []string
+	for app, components := range health.Status.Applications {
+		appUnhealthy := map[commonv1alpha1.Criticality]bool{}
+		appUnknown := map[commonv1alpha1.Criticality]bool{}
+		for component, status := range components {
+			if spec.Healthy(status) || status.SilencedBy != "" {
+				continue
+			}
+			c := criticality(spec, app, component)
+			if status.Status == commonv1alpha1.StatusUnknown {
+				appUnknown[c] = true
+				unknown[c] = true
+				if rollupStatus(&spec.Rollup, map[commonv1alpha1.Criticality]bool{c: true}) != commonv1alpha1.StatusReady {
+					unknownComponents = append(unknownComponents, app+"/"+component)
+				}
+				continue
+			}
+			appUnhealthy[c] = true
+			unhealthy[c] = true
+			switch rollupStatus(&spec.Rollup, map[commonv1alpha1.Criticality]bool{c: true}) {
+			case commonv1alpha1.StatusDown:
+				down = append(down, app+"/"+component)
+			case commonv1alpha1.StatusDegraded:
+				degraded = append(degraded, app+"/"+component)
+			}
+		}
+		if rollup.Applications == nil {
+			rollup.Applications = map[string]string{}
+		}
+		rollup.Applications[app] = rollupKnownStatus(&spec.Rollup, appUnhealthy, appUnknown)
+	}
+	rollup.Status = rollupKnownStatus(&spec.Rollup, unhealthy, unknown)
+
+	rollup.Down = firstComponents(down)
+	rollup.Degraded = firstComponents(degraded)
+	rollup.Unknown = firstComponents(unknownComponents)
+	return rollup
+}
+
+// rollupKnownStatus returns the rollup status of the unhealthy
+// criticalities, or unknown when it is ready but the unknown ones would
+// make it down or degraded
+func rollupKnownStatus(policy *commonv1alpha1.RollupPolicy, unhealthy, unknown map[commonv1alpha1.Criticality]bool) string {
+	status := rollupStatus(policy, unhealthy)
+	if status == commonv1alpha1.StatusReady && rollupStatus(policy, unknown) != commonv1alpha1.StatusReady {
+		return commonv1alpha1.StatusUnknown
+	}
+	return status
+}
+
+// firstComponents sorts names and keeps the first maxListedComponents
+func firstComponents(names []string) []string {
+	sort.Strings(names)
+	if len(names) > maxListedComponents {
+		names = names[:maxListedComponents]
+	}
+	return names
+}
+
+// staleRemoveFactor is how many times longer than their stale threshold
+// components are kept without an evaluation. Their source is gone and was
+// deleted while the operator was not running.
+const staleRemoveFactor = 4
+
+// markStale sets the status of the components of health which were not
+// evaluated for longer than StaleAfter to unknown, removes the ones not
+// evaluated for staleRemoveFactor times longer and returns when the next
+// component becomes stale or is removed, zero when none will
+func markStale(health *commonv1alpha1.Health, now time.Time) time.Time {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			if status.LastEvaluated == nil {
+				continue
+			}
+			staleAfter := health.Spec.ComponentStaleAfter(status)
+			if !health.Spec.Stale(status, now) {
+				earliest(status.LastEvaluated.Add(staleAfter))
+				continue
+			}
+			removal := status.LastEvaluated.Add(staleRemoveFactor * staleAfter)
+			if !removal.After(now) {
+				delete(components, component)
+				continue
+			}
+			earliest(removal)
+			if status.Status == commonv1alpha1.StatusUnknown && status.Reason == "Stale" {
+				continue
+			}
+			status.Message = fmt.Sprintf("%s when last evaluated at %s", status.Status, status.LastEvaluated.UTC().Format(time.RFC3339))
+			status.Status = commonv1alpha1.StatusUnknown
+			status.Reason = "Stale"
+			components[component] = status
+		}
+		if len(components) == 0 {
+			delete(health.Status.Applications, app)
+		}
+	}
+	return next
+}
@@ -0,0 +1,248 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestMarkStale(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	evaluated := func(ago time.Duration) *metav1.Time {
+		return &metav1.Time{Time: now.Add(-ago)}
+	}
+	health := &commonv1alpha1.Health{}
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Status: commonv1alpha1.StatusReady, LastEvaluated: evaluated(time.Minute)},
+			"scheduler": {Status: commonv1alpha1.StatusReady, LastEvaluated: evaluated(20 * time.Minute)},
+			"conductor": {Status: commonv1alpha1.StatusReady, LastEvaluated: evaluated(2 * time.Hour)},
+			"legacy":    {Status: commonv1alpha1.StatusReady},
+			"check": {
+				Status:        commonv1alpha1.StatusReady,
+				LastEvaluated: evaluated(20 * time.Minute),
+				Interval:      &metav1.Duration{Duration: 30 * time.Minute},
+			},
+		},
+		"glance": {
+			"api": {Status: commonv1alpha1.StatusReady, LastEvaluated: evaluated(2 * time.Hour)},
+		},
+	}
+
+	next := markStale(health, now)
+	if want := now.Add(14 * time.Minute); !next.Equal(want) {
+		t.Errorf("next %s, want %s", next, want)
+	}
+	nova := health.Status.Applications["nova"]
+	for component, want := range map[string]string{
+		"api":       commonv1alpha1.StatusReady,
+		"scheduler": commonv1alpha1.StatusUnknown,
+		"legacy":    commonv1alpha1.StatusReady,
+		"check":     commonv1alpha1.StatusReady,
+	} {
+		if status := nova[component].Status; status != want {
+			t.Errorf("%s is %s, want %s", component, status, want)
+		}
+	}
+	if nova["scheduler"].Reason != "Stale" {
+		t.Errorf("scheduler reason %s, want Stale", nova["scheduler"].Reason)
+	}
+	if _, ok := nova["conductor"]; ok {
+		t.Errorf("component not evaluated for long is kept")
+	}
+	if _, ok := health.Status.Applications["glance"]; ok {
+		t.Errorf("application without components is kept")
+	}
+}
+
+func TestCriticality(t *testing.T) {
+	spec := &commonv1alpha1.HealthSpec{Criticality: map[string]commonv1alpha1.Criticality{
+		"mariadb":        commonv1alpha1.CriticalityCritical,
+		"mariadb/backup": commonv1alpha1.CriticalityOptional,
+	}}
+	tests := []struct {
+		app, component string
+		criticality    commonv1alpha1.Criticality
+	}{
+		{"mariadb", "server", commonv1alpha1.CriticalityCritical},
+		{"mariadb", "backup", commonv1alpha1.CriticalityOptional},
+		{"nova", "api", commonv1alpha1.CriticalityNormal},
+	}
+	for _, test := range tests {
+		if c := criticality(spec, test.app, test.component); c != test.criticality {
+			t.Errorf("%s/%s: criticality %s, want %s", test.app, test.component, c, test.criticality)
+		}
+	}
+}
+
+func TestRollupStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    commonv1alpha1.RollupPolicy
+		unhealthy []commonv1alpha1.Criticality
+		status    string
+	}{
+		{
+			name:   "healthy",
+			status: commonv1alpha1.StatusReady,
+		},
+		{
+			name:      "critical",
+			unhealthy: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityCritical, commonv1alpha1.CriticalityNormal},
+			status:    commonv1alpha1.StatusDown,
+		},
+		{
+			name:      "normal",
+			unhealthy: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityNormal},
+			status:    commonv1alpha1.StatusDegraded,
+		},
+		{
+			name:      "optional",
+			unhealthy: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityOptional},
+			status:    commonv1alpha1.StatusReady,
+		},
+		{
+			name: "policy",
+			policy: commonv1alpha1.RollupPolicy{
+				Down:     []commonv1alpha1.Criticality{commonv1alpha1.CriticalityCritical, commonv1alpha1.CriticalityNormal},
+				Degraded: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityOptional},
+			},
+			unhealthy: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityNormal},
+			status:    commonv1alpha1.StatusDown,
+		},
+		{
+			name:      "policy degraded by optional",
+			policy:    commonv1alpha1.RollupPolicy{Degraded: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityOptional}},
+			unhealthy: []commonv1alpha1.Criticality{commonv1alpha1.CriticalityOptional},
+			status:    commonv1alpha1.StatusDegraded,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unhealthy := map[commonv1alpha1.Criticality]bool{}
+			for _, c := range test.unhealthy {
+				unhealthy[c] = true
+			}
+			if status := rollupStatus(&test.policy, unhealthy); status != test.status {
+				t.Errorf("status %s, want %s", status, test.status)
+			}
+		})
+	}
+}
+
+func TestRollupHealth(t *testing.T) {
+	ready := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady}
+	notReady := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady}
+	unknown := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusUnknown}
+	silenced := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, SilencedBy: "upgrade"}
+	criticalities := map[string]commonv1alpha1.Criticality{
+		"mariadb":         commonv1alpha1.CriticalityCritical,
+		"nova/novncproxy": commonv1alpha1.CriticalityOptional,
+	}
+	tests := []struct {
+		name         string
+		applications map[string]commonv1alpha1.ApplicationStatus
+		rollup       commonv1alpha1.RollupStatus
+	}{
+		{
+			name: "healthy",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"mariadb": {"server": ready},
+				"nova":    {"api": ready, "novncproxy": ready},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusReady,
+				Applications: map[string]string{"mariadb": commonv1alpha1.StatusReady, "nova": commonv1alpha1.StatusReady},
+			},
+		},
+		{
+			name: "critical component down",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"mariadb": {"server": notReady},
+				"nova":    {"api": notReady},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusDown,
+				Applications: map[string]string{"mariadb": commonv1alpha1.StatusDown, "nova": commonv1alpha1.StatusDegraded},
+				Down:         []string{"mariadb/server"},
+				Degraded:     []string{"nova/api"},
+			},
+		},
+		{
+			name: "optional component failed",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"nova": {"api": ready, "novncproxy": notReady},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusReady,
+				Applications: map[string]string{"nova": commonv1alpha1.StatusReady},
+			},
+		},
+		{
+			name: "unknown component",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"mariadb": {"server": unknown},
+				"nova":    {"api": ready, "novncproxy": unknown},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusUnknown,
+				Applications: map[string]string{"mariadb": commonv1alpha1.StatusUnknown, "nova": commonv1alpha1.StatusReady},
+				Unknown:      []string{"mariadb/server"},
+			},
+		},
+		{
+			name: "unhealthy component outweighs unknown one",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"mariadb": {"server": unknown},
+				"nova":    {"api": notReady},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusDegraded,
+				Applications: map[string]string{"mariadb": commonv1alpha1.StatusUnknown, "nova": commonv1alpha1.StatusDegraded},
+				Degraded:     []string{"nova/api"},
+				Unknown:      []string{"mariadb/server"},
+			},
+		},
+		{
+			name: "silenced component",
+			applications: map[string]commonv1alpha1.ApplicationStatus{
+				"mariadb": {"server": silenced},
+				"nova":    {"api": ready},
+			},
+			rollup: commonv1alpha1.RollupStatus{
+				Status:       commonv1alpha1.StatusReady,
+				Applications: map[string]string{"mariadb": commonv1alpha1.StatusReady, "nova": commonv1alpha1.StatusReady},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Spec.Criticality = criticalities
+			health.Status.Applications = test.applications
+			if rollup := rollupHealth(health); !reflect.DeepEqual(*rollup, test.rollup) {
+				t.Errorf("rollup %+v, want %+v", *rollup, test.rollup)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// MinReadyEndpointsAnnotation on a Service is the number of ready endpoints
+// required for its component to be ready, 1 by default
+const MinReadyEndpointsAnnotation = "common.amadev.ru/min-ready-endpoints"
+
+// ServiceHealthReconciler records the ready endpoints of Services in the
+// components identified by the Service metadata
+type ServiceHealthReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// minReadyEndpoints returns the number of ready endpoints required for obj,
+// the default of 1 with an error for invalid annotations
+func minReadyEndpoints(obj *corev1.Service) (int32, error) {
+	value, ok := obj.Annotations[MinReadyEndpointsAnnotation]
+	if !ok {
+		return 1, nil
+	}
+	minimum, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 1, err
+	}
+	if minimum < 0 {
+		return 1, fmt.Errorf("negative number of endpoints %d", minimum)
+	}
+	return int32(minimum), nil
+}
+
+// endpointsPatch returns a merge patch setting the endpoints of service in
+// a component, or removing them when endpoints is nil
+func endpointsPatch(app, component, service string, endpoints *commonv1alpha1.EndpointStatus) ([]byte, error) {
+	data, err := json.Marshal(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(map[string]json.RawMessage{service: data})
+	if err != nil {
+		return nil, err
+	}
+	return componentPatch(app, component, map[string]json.RawMessage{"endpoints": value})
+}
+
+// clearEndpoints removes the endpoints of service from the components of
+// health which recorded them, except from keep given as app/component. A
+// Service which was deleted or identifies another component now leaves no
+// endpoints behind.
+func (r *ServiceHealthReconciler) clearEndpoints(ctx context.Context, health *commonv1alpha1.Health, service, keep string) error {
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			if _, ok := status.Endpoints[service]; !ok || app+"/"+component == keep {
+				continue
+			}
+			patch, err := endpointsPatch(app, component, service, nil)
+			if err != nil {
+				return err
+			}
+			err = r.Status().Patch(ctx, health, client.RawPatch(types.MergePatchType, patch))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readyEndpoints counts the distinct ready endpoints in slices. An endpoint
+// without the ready condition is ready, as defined by the EndpointSlice API.
+func readyEndpoints(slices []discoveryv1beta1.EndpointSlice) int32 {
+	seen := map[string]bool{}
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			// dual stack Services have one slice per address family
+			var key string
+			if endpoint.TargetRef != nil {
+				key = string(endpoint.TargetRef.UID)
+			} else if len(endpoint.Addresses) > 0 {
+				key = endpoint.Addresses[0]
+			}
+			seen[key] = true
+		}
+	}
+	return int32(len(seen))
+}
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+
+func (r *ServiceHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("servicehealth", req.NamespacedName)
+	found := &corev1.Service{}
+	log.Info("Got reconcile request")
+
+	health := &commonv1alpha1.Health{}
+	err := r.Get(ctx, types.NamespacedName{Name: "health", Namespace: req.Namespace}, health)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Health resource not found. Until health object is present in the namespace, summary will not be created")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Health")
+		return ctrl.Result{}, err
+	}
+
+	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Object was deleted. Clearing its endpoints")
+			err = r.clearEndpoints(ctx, health, req.Name, "")
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
+
+		log.Error(err, "Failed to get an object")
+		return ctrl.Result{}, err
+	}
+
+	// Services without a selector are not backed by a workload
+	if found.Spec.Type == corev1.ServiceTypeExternalName || len(found.Spec.Selector) == 0 {
+		log.Info("Service has no selector. Skipping")
+		err = r.clearEndpoints(ctx, health, found.Name, "")
+		if err != nil {
+			log.Error(err, "Failed to update Health status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	minimum, err := minReadyEndpoints(found)
+	if err != nil {
+		log.Error(err, "Invalid annotation, using the default", "annotation", MinReadyEndpointsAnnotation,
+			"value", found.Annotations[MinReadyEndpointsAnnotation], "default", minimum)
+	}
+
+	app, component := getIdentity(found.ObjectMeta)
+	log.Info("Identification", "app", app, "component", component)
+	err = r.clearEndpoints(ctx, health, found.Name, app+"/"+component)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	// Services without a workload of their own, like headless discovery
+	// Services, would otherwise create components without a status
+	if status, ok := health.Status.Applications[app][component]; !ok || status.Status == "" {
+		log.Info("Component has no workload status. Skipping")
+		return ctrl.Result{RequeueAfter: resyncPeriod}, nil
+	}
+
+	slices := &discoveryv1beta1.EndpointSliceList{}
+	err = r.List(ctx, slices, client.InNamespace(found.Namespace),
+		client.MatchingLabels{discoveryv1beta1.LabelServiceName: found.Name})
+	if err != nil {
+		log.Error(err, "Failed to list EndpointSlices")
+		return ctrl.Result{}, err
+	}
+
+	endpoints := commonv1alpha1.EndpointStatus{
+		Ready:   readyEndpoints(slices.Items),
+		Minimum: minimum,
+	}
+	log.Info("Endpoints", "ready", endpoints.Ready, "minimum", endpoints.Minimum)
+
+	// several Services may select the same component, each keeps its own
+	// entry
+	patch, err := endpointsPatch(app, component, found.Name, &endpoints)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
+
+	err = r.Status().Patch(
+		ctx,
+		health,
+		client.RawPatch(types.MergePatchType, patch))
+
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// sliceToService maps an EndpointSlice to the Service it belongs to
+func sliceToService(obj handler.MapObject) []reconcile.Request {
+	name, ok := obj.Meta.GetLabels()[discoveryv1beta1.LabelServiceName]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.Meta.GetNamespace(), Name: name}}}
+}
+
+func (r *ServiceHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}).
+		Watches(&source.Kind{Type: &discoveryv1beta1.EndpointSlice{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(sliceToService)}).
+		Complete(r)
+}
@@ -0,0 +1,222 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestMinReadyEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   *string
+		minimum int32
+		invalid bool
+	}{
+		{name: "default", minimum: 1},
+		{name: "annotated", value: stringPtr("3"), minimum: 3},
+		{name: "none required", value: stringPtr("0"), minimum: 0},
+		{name: "negative", value: stringPtr("-1"), minimum: 1, invalid: true},
+		{name: "not a number", value: stringPtr("two"), minimum: 1, invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &corev1.Service{}
+			if test.value != nil {
+				service.Annotations = map[string]string{MinReadyEndpointsAnnotation: *test.value}
+			}
+			minimum, err := minReadyEndpoints(service)
+			if minimum != test.minimum || (err != nil) != test.invalid {
+				t.Errorf("minimum %d with error %v, want %d with error %v", minimum, err, test.minimum, test.invalid)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestReadyEndpoints(t *testing.T) {
+	ready, notReady := true, false
+	endpoint := func(uid string, address string, isReady *bool) discoveryv1beta1.Endpoint {
+		e := discoveryv1beta1.Endpoint{Addresses: []string{address}, Conditions: discoveryv1beta1.EndpointConditions{Ready: isReady}}
+		if uid != "" {
+			e.TargetRef = &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid)}
+		}
+		return e
+	}
+	tests := []struct {
+		name   string
+		slices []discoveryv1beta1.EndpointSlice
+		ready  int32
+	}{
+		{name: "no slices"},
+		{
+			name: "ready and not ready",
+			slices: []discoveryv1beta1.EndpointSlice{{Endpoints: []discoveryv1beta1.Endpoint{
+				endpoint("a", "10.0.0.1", &ready),
+				endpoint("b", "10.0.0.2", &notReady),
+				endpoint("c", "10.0.0.3", nil),
+			}}},
+			ready: 2,
+		},
+		{
+			name: "dual stack pods are counted once",
+			slices: []discoveryv1beta1.EndpointSlice{
+				{AddressType: discoveryv1beta1.AddressTypeIPv4, Endpoints: []discoveryv1beta1.Endpoint{endpoint("a", "10.0.0.1", &ready)}},
+				{AddressType: discoveryv1beta1.AddressTypeIPv6, Endpoints: []discoveryv1beta1.Endpoint{endpoint("a", "fd00::1", &ready)}},
+			},
+			ready: 1,
+		},
+		{
+			name: "endpoints without a target",
+			slices: []discoveryv1beta1.EndpointSlice{{Endpoints: []discoveryv1beta1.Endpoint{
+				endpoint("", "192.168.0.1", &ready),
+				endpoint("", "192.168.0.2", &ready),
+			}}},
+			ready: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if ready := readyEndpoints(test.slices); ready != test.ready {
+				t.Errorf("%d ready endpoints, want %d", ready, test.ready)
+			}
+		})
+	}
+}
+
+func TestServiceEndpoints(t *testing.T) {
+	health := &commonv1alpha1.Health{}
+	health.Name, health.Namespace = "health", "openstack"
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Status: commonv1alpha1.StatusReady},
+			"scheduler": {Status: commonv1alpha1.StatusReady},
+		},
+	}
+	ready := true
+	objects := []runtime.Object{health}
+	for i, name := range []string{"nova-api", "nova-metadata"} {
+		service := &corev1.Service{}
+		service.Name, service.Namespace = name, health.Namespace
+		service.Labels = map[string]string{"application": "nova", "component": "api"}
+		service.Spec.Selector = map[string]string{"application": "nova", "component": "api"}
+		slice := &discoveryv1beta1.EndpointSlice{}
+		slice.Name, slice.Namespace = name+"-1", health.Namespace
+		slice.Labels = map[string]string{discoveryv1beta1.LabelServiceName: name}
+		for j := 0; j < i; j++ {
+			slice.Endpoints = append(slice.Endpoints, discoveryv1beta1.Endpoint{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1beta1.EndpointConditions{Ready: &ready},
+			})
+		}
+		objects = append(objects, service, slice)
+	}
+	c := fake.NewFakeClientWithScheme(testScheme(t), objects...)
+	r := &ServiceHealthReconciler{Client: c, Log: ctrl.Log}
+	reconcile := func(name string) {
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: health.Namespace}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	endpoints := func(component string) map[string]commonv1alpha1.EndpointStatus {
+		current := &commonv1alpha1.Health{}
+		if err := c.Get(context.Background(), types.NamespacedName{Name: health.Name, Namespace: health.Namespace}, current); err != nil {
+			t.Fatal(err)
+		}
+		return current.Status.Applications["nova"][component].Endpoints
+	}
+
+	reconcile("nova-api")
+	reconcile("nova-metadata")
+	want := map[string]commonv1alpha1.EndpointStatus{
+		"nova-api":      {Ready: 0, Minimum: 1},
+		"nova-metadata": {Ready: 1, Minimum: 1},
+	}
+	if e := endpoints("api"); !reflect.DeepEqual(e, want) {
+		t.Errorf("endpoints %v, want %v", e, want)
+	}
+
+	// the Service identifies another component now
+	service := &corev1.Service{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "nova-api", Namespace: health.Namespace}, service); err != nil {
+		t.Fatal(err)
+	}
+	service.Labels["component"] = "scheduler"
+	if err := c.Update(context.Background(), service); err != nil {
+		t.Fatal(err)
+	}
+	reconcile("nova-api")
+	want = map[string]commonv1alpha1.EndpointStatus{"nova-metadata": {Ready: 1, Minimum: 1}}
+	if e := endpoints("api"); !reflect.DeepEqual(e, want) {
+		t.Errorf("endpoints %v, want %v", e, want)
+	}
+	want = map[string]commonv1alpha1.EndpointStatus{"nova-api": {Ready: 0, Minimum: 1}}
+	if e := endpoints("scheduler"); !reflect.DeepEqual(e, want) {
+		t.Errorf("endpoints %v, want %v", e, want)
+	}
+
+	if err := c.Delete(context.Background(), service); err != nil {
+		t.Fatal(err)
+	}
+	reconcile("nova-api")
+	if e := endpoints("scheduler"); len(e) != 0 {
+		t.Errorf("endpoints %v of a deleted Service", e)
+	}
+}
+
+func TestEndpointsReady(t *testing.T) {
+	spec := commonv1alpha1.HealthSpec{}
+	tests := []struct {
+		name      string
+		endpoints map[string]commonv1alpha1.EndpointStatus
+		healthy   bool
+	}{
+		{name: "no Service", healthy: true},
+		{name: "enough", endpoints: map[string]commonv1alpha1.EndpointStatus{"nova-api": {Ready: 2, Minimum: 2}}, healthy: true},
+		{name: "too few", endpoints: map[string]commonv1alpha1.EndpointStatus{"nova-api": {Ready: 1, Minimum: 2}}},
+		{
+			name: "one of several Services",
+			endpoints: map[string]commonv1alpha1.EndpointStatus{
+				"nova-api":      {Ready: 2, Minimum: 1},
+				"nova-metadata": {Ready: 0, Minimum: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Endpoints: test.endpoints}
+			if healthy := spec.Healthy(status); healthy != test.healthy {
+				t.Errorf("healthy %v, want %v", healthy, test.healthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// silenceStart is when a silence starts, its creation by default
+func silenceStart(silence *commonv1alpha1.HealthSilence) time.Time {
+	if silence.Spec.StartsAt != nil {
+		return silence.Spec.StartsAt.Time
+	}
+	return silence.CreationTimestamp.Time
+}
+
+// silenceActive reports whether now is in the time range of silence
+func silenceActive(silence *commonv1alpha1.HealthSilence, now time.Time) bool {
+	return !now.Before(silenceStart(silence)) && now.Before(silence.Spec.EndsAt.Time)
+}
+
+// silenceMatches reports whether silence selects the component of app. An
+// application reference selects all its components.
+func silenceMatches(silence *commonv1alpha1.HealthSilence, app, component string) bool {
+	for _, pattern := range silence.Spec.Components {
+		if !strings.Contains(pattern, "/") {
+			pattern += "/*"
+		}
+		if ok, _ := path.Match(pattern, app+"/"+component); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applySilences sets SilencedBy of the components of health matching one of
+// the active silences and returns when the next silence starts or ends,
+// zero when none will
+func applySilences(health *commonv1alpha1.Health, silences []commonv1alpha1.HealthSilence, now time.Time) time.Time {
+	sort.Slice(silences, func(i, j int) bool { return silences[i].Name < silences[j].Name })
+	var next time.Time
+	earliest := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for i := range silences {
+		earliest(silenceStart(&silences[i]))
+		earliest(silences[i].Spec.EndsAt.Time)
+	}
+
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			status.SilencedBy = ""
+			for i := range silences {
+				if silenceActive(&silences[i], now) && silenceMatches(&silences[i], app, component) {
+					status.SilencedBy = silences[i].Name
+					break
+				}
+			}
+			components[component] = status
+		}
+	}
+	return next
+}
+
+// earlier returns the earlier of two times, ignoring zero ones
+func earlier(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,125 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	tests := []struct {
+		components []string
+		app        string
+		component  string
+		matches    bool
+	}{
+		{components: []string{"nova"}, app: "nova", component: "api", matches: true},
+		{components: []string{"nova/api"}, app: "nova", component: "api", matches: true},
+		{components: []string{"nova/*-api"}, app: "nova", component: "placement-api", matches: true},
+		{components: []string{"nova/*-api"}, app: "nova", component: "scheduler"},
+		{components: []string{"nova"}, app: "novaproxy", component: "api"},
+		{components: []string{"glance", "nova/sched*"}, app: "nova", component: "scheduler", matches: true},
+	}
+	for _, test := range tests {
+		silence := &commonv1alpha1.HealthSilence{Spec: commonv1alpha1.HealthSilenceSpec{Components: test.components}}
+		if matches := silenceMatches(silence, test.app, test.component); matches != test.matches {
+			t.Errorf("%v matches %s/%s %v, want %v", test.components, test.app, test.component, matches, test.matches)
+		}
+	}
+}
+
+func TestApplySilences(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	silence := func(name string, components []string, start, end time.Duration) commonv1alpha1.HealthSilence {
+		s := commonv1alpha1.HealthSilence{Spec: commonv1alpha1.HealthSilenceSpec{
+			Components: components,
+			EndsAt:     metav1.NewTime(now.Add(end)),
+		}}
+		s.Name = name
+		s.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+		if start != 0 {
+			s.Spec.StartsAt = &metav1.Time{Time: now.Add(start)}
+		}
+		return s
+	}
+	tests := []struct {
+		name     string
+		silences []commonv1alpha1.HealthSilence
+		silenced map[string]string
+		next     time.Duration
+	}{
+		{
+			name:     "no silences",
+			silenced: map[string]string{"api": "", "scheduler": ""},
+		},
+		{
+			name:     "active silence",
+			silences: []commonv1alpha1.HealthSilence{silence("upgrade", []string{"nova/api"}, 0, time.Hour)},
+			silenced: map[string]string{"api": "upgrade", "scheduler": ""},
+			next:     time.Hour,
+		},
+		{
+			name:     "pending silence",
+			silences: []commonv1alpha1.HealthSilence{silence("upgrade", []string{"nova"}, 10*time.Minute, time.Hour)},
+			silenced: map[string]string{"api": "", "scheduler": ""},
+			next:     10 * time.Minute,
+		},
+		{
+			name:     "ended silence",
+			silences: []commonv1alpha1.HealthSilence{silence("upgrade", []string{"nova"}, -time.Hour, -time.Minute)},
+			silenced: map[string]string{"api": "", "scheduler": ""},
+		},
+		{
+			name: "first silence by name",
+			silences: []commonv1alpha1.HealthSilence{
+				silence("b-maintenance", []string{"nova"}, 0, 2*time.Hour),
+				silence("a-upgrade", []string{"nova/scheduler"}, 0, time.Hour),
+			},
+			silenced: map[string]string{"api": "b-maintenance", "scheduler": "a-upgrade"},
+			next:     time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+				"nova": {
+					"api":       {Status: commonv1alpha1.StatusDown},
+					"scheduler": {Status: commonv1alpha1.StatusReady, SilencedBy: "removed"},
+				},
+			}
+			next := applySilences(health, test.silences, now)
+			var want time.Time
+			if test.next != 0 {
+				want = now.Add(test.next)
+			}
+			if !next.Equal(want) {
+				t.Errorf("next %s, want %s", next, want)
+			}
+			for component, silencedBy := range test.silenced {
+				if got := health.Status.Applications["nova"][component].SilencedBy; got != silencedBy {
+					t.Errorf("%s silenced by %q, want %q", component, got, silencedBy)
+				}
+			}
+		})
+	}
+}
@@ -18,13 +18,22 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
 )
@@ -35,19 +44,90 @@ type StatefulSetHealthReconciler struct {
 	Scheme *runtime.Scheme
 }
 
-func (r *StatefulSetHealthReconciler) calculateStatus(obj *appsv1.StatefulSet) string {
-	status := "notready"
+// calculateStatus compares the replica counters of obj. A partition or
+// the OnDelete strategy intentionally leave pods on the current revision,
+// such a StatefulSet is partially rolled once the expected pods are updated.
+func (r *StatefulSetHealthReconciler) calculateStatus(obj *appsv1.StatefulSet) commonv1alpha1.ComponentStatus {
+	status := commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady}
 
 	if obj.Status.Replicas == obj.Status.CurrentReplicas &&
 		obj.Status.Replicas == obj.Status.ReadyReplicas &&
 		obj.Status.Replicas == obj.Status.Replicas &&
 		obj.Status.Replicas == obj.Status.UpdatedReplicas {
-		status = "ready"
+		status.Status = commonv1alpha1.StatusReady
+		return status
 	}
 
+	replicas := int32(1)
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	if obj.Status.ObservedGeneration < obj.Generation ||
+		obj.Status.Replicas != replicas ||
+		obj.Status.ReadyReplicas != replicas ||
+		obj.Status.CurrentRevision == obj.Status.UpdateRevision {
+		return status
+	}
+
+	strategy := obj.Spec.UpdateStrategy
+	switch {
+	case strategy.Type == appsv1.OnDeleteStatefulSetStrategyType:
+		status.Status = commonv1alpha1.StatusPartiallyRolled
+		status.Reason = "OnDelete"
+		status.Message = fmt.Sprintf("%d of %d pods updated to revision %s, pods are updated when deleted",
+			obj.Status.UpdatedReplicas, replicas, obj.Status.UpdateRevision)
+	case strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil && *strategy.RollingUpdate.Partition > 0:
+		partition := *strategy.RollingUpdate.Partition
+		expected := replicas - partition
+		if expected < 0 {
+			expected = 0
+		}
+		if obj.Status.UpdatedReplicas < expected {
+			return status
+		}
+		status.Status = commonv1alpha1.StatusPartiallyRolled
+		status.Reason = "Partitioned"
+		status.Message = fmt.Sprintf("%d of %d pods updated to revision %s, pods with ordinal below %d keep revision %s",
+			obj.Status.UpdatedReplicas, replicas, obj.Status.UpdateRevision, partition, obj.Status.CurrentRevision)
+		status.Partition = &partition
+	}
 	return status
 }
 
+// diagnose summarizes the pods controlled by obj
+func (r *StatefulSetHealthReconciler) diagnose(ctx context.Context, obj *appsv1.StatefulSet) ([]commonv1alpha1.PodDiagnostic, error) {
+	pods, err := ownedPods(ctx, r.Client, obj.Namespace, obj.Spec.Selector, map[types.UID]bool{obj.UID: true})
+	if err != nil {
+		return nil, err
+	}
+	return diagnosePods(pods), nil
+}
+
+// claimToStatefulSet maps a claim to the StatefulSet it was created for
+func (r *StatefulSetHealthReconciler) claimToStatefulSet(obj handler.MapObject) []reconcile.Request {
+	statefulSets := &appsv1.StatefulSetList{}
+	err := r.List(context.Background(), statefulSets, client.InNamespace(obj.Meta.GetNamespace()))
+	if err != nil {
+		return nil
+	}
+	for i := range statefulSets.Items {
+		statefulSet := &statefulSets.Items[i]
+		for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+			prefix := template.Name + "-" + statefulSet.Name + "-"
+			ordinal := strings.TrimPrefix(obj.Meta.GetName(), prefix)
+			if ordinal == obj.Meta.GetName() {
+				continue
+			}
+			if _, err := strconv.Atoi(ordinal); err == nil {
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: statefulSet.Name, Namespace: statefulSet.Namespace}}}
+			}
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch
+
 func (r *StatefulSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("statufulsethealth", req.NamespacedName)
@@ -68,8 +148,12 @@ func (r *StatefulSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 	err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, found)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			log.Info("Object was deleted. Finalazer is not used. Skipping that case")
-			return ctrl.Result{}, nil
+			log.Info("Object was deleted, removing its component")
+			err = removeComponentsOf(ctx, r.Client, health, componentSource("StatefulSet", req.Name), nil)
+			if err != nil {
+				log.Error(err, "Failed to update Health status")
+			}
+			return ctrl.Result{}, err
 		}
 
 		log.Error(err, "Failed to get an object")
@@ -80,26 +164,69 @@ func (r *StatefulSetHealthReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 	log.Info("Identification", "app", app, "component", component)
 
 	status := r.calculateStatus(found)
+	status.Generation = found.Generation
+	if scaledDown(found.Spec.Replicas, found.Status.Replicas) {
+		status = commonv1alpha1.ComponentStatus{
+			Status:     commonv1alpha1.StatusScaledDown,
+			Generation: found.Generation,
+		}
+		status.Reason, status.Message = scaledDownReason(found.ObjectMeta)
+	}
+	status.Volumes, err = diagnoseVolumes(ctx, r.Client, found)
+	if err != nil {
+		log.Error(err, "Failed to diagnose volumes")
+	}
+	if reason := volumeProblem(status.Volumes); reason != "" {
+		status.Status = commonv1alpha1.StatusNotReady
+		status.Reason = reason
+		status.Message = ""
+		status.Partition = nil
+	}
+	if status.Status == commonv1alpha1.StatusNotReady {
+		status.Diagnostics, err = r.diagnose(ctx, found)
+		if err != nil {
+			log.Error(err, "Failed to diagnose pods")
+		}
+	}
 
-	log.Info("Status", "status", status)
-
-	patch := getPatch(app, component, status, found.Generation)
-
-	err = r.Status().Patch(
-		ctx,
-		health,
-		client.RawPatch(types.MergePatchType, patch))
+	log.Info("Status", "status", status.Status, "reason", status.Reason)
+
+	now := time.Now()
+	status, wait := applyHysteresis(health, app, component, status, now)
+	status.Source = componentSource("StatefulSet", found.Name)
+	// the rollout is recorded as observed, regardless of the hysteresis
+	status.Rollout = trackRollout(health, app, component, commonv1alpha1.Rollout{
+		Generation: found.Generation,
+		Revision:   found.Status.UpdateRevision,
+		Images:     templateImages(&found.Spec.Template),
+	}, statefulSetRolledOut(found), now)
+	patch, err := getPatch(health, app, component, status)
+	if err != nil {
+		log.Error(err, "Failed to build Health status patch")
+		return ctrl.Result{}, err
+	}
 
+	err = patchHealthStatus(ctx, r.Client, health, patch)
+	if err != nil {
+		log.Error(err, "Failed to update Health status")
+		return ctrl.Result{}, err
+	}
+	// a changed identity leaves the component reported before behind
+	err = removeComponentsOf(ctx, r.Client, health, status.Source, map[string]bool{app + "/" + component: true})
 	if err != nil {
 		log.Error(err, "Failed to update Health status")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter(wait)}, nil
 }
 
 func (r *StatefulSetHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.StatefulSet{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &appsv1.StatefulSet{}, IsController: true}).
+		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.claimToStatefulSet)}).
 		Complete(r)
 }
@@ -0,0 +1,96 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func TestStatefulSetCalculateStatus(t *testing.T) {
+	// statefulSet has 3 ready replicas of which updated are on the update
+	// revision
+	statefulSet := func(updated int32, strategy appsv1.StatefulSetUpdateStrategy) *appsv1.StatefulSet {
+		replicas := int32(3)
+		obj := &appsv1.StatefulSet{}
+		obj.Generation = 4
+		obj.Spec.Replicas = &replicas
+		obj.Spec.UpdateStrategy = strategy
+		obj.Status.ObservedGeneration = 4
+		obj.Status.Replicas = 3
+		obj.Status.ReadyReplicas = 3
+		obj.Status.CurrentReplicas = 3 - updated
+		obj.Status.UpdatedReplicas = updated
+		obj.Status.CurrentRevision = "mariadb-server-1"
+		obj.Status.UpdateRevision = "mariadb-server-2"
+		if updated == 3 {
+			obj.Status.CurrentReplicas = 3
+			obj.Status.CurrentRevision = obj.Status.UpdateRevision
+		}
+		return obj
+	}
+	partition := func(n int32) appsv1.StatefulSetUpdateStrategy {
+		return appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &n},
+		}
+	}
+	rollingUpdate := appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+	onDelete := appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+
+	notObserved := statefulSet(1, onDelete)
+	notObserved.Generation = 5
+	notReady := statefulSet(1, onDelete)
+	notReady.Status.ReadyReplicas = 2
+
+	tests := []struct {
+		name      string
+		obj       *appsv1.StatefulSet
+		status    string
+		reason    string
+		partition int32
+	}{
+		{name: "rolled out", obj: statefulSet(3, rollingUpdate), status: commonv1alpha1.StatusReady},
+		{name: "rolling update in progress", obj: statefulSet(1, rollingUpdate), status: commonv1alpha1.StatusNotReady},
+		{name: "partition reached", obj: statefulSet(1, partition(2)), status: commonv1alpha1.StatusPartiallyRolled, reason: "Partitioned", partition: 2},
+		{name: "partition beyond the replicas", obj: statefulSet(0, partition(5)), status: commonv1alpha1.StatusPartiallyRolled, reason: "Partitioned", partition: 5},
+		{name: "partition not reached", obj: statefulSet(1, partition(1)), status: commonv1alpha1.StatusNotReady},
+		{name: "zero partition", obj: statefulSet(1, partition(0)), status: commonv1alpha1.StatusNotReady},
+		{name: "on delete", obj: statefulSet(1, onDelete), status: commonv1alpha1.StatusPartiallyRolled, reason: "OnDelete"},
+		{name: "on delete not updated", obj: statefulSet(0, onDelete), status: commonv1alpha1.StatusPartiallyRolled, reason: "OnDelete"},
+		{name: "generation not observed", obj: notObserved, status: commonv1alpha1.StatusNotReady},
+		{name: "pods not ready", obj: notReady, status: commonv1alpha1.StatusNotReady},
+	}
+	r := &StatefulSetHealthReconciler{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := r.calculateStatus(test.obj)
+			if status.Status != test.status || status.Reason != test.reason {
+				t.Errorf("status %s with reason %q, want %s with reason %q", status.Status, status.Reason, test.status, test.reason)
+			}
+			switch {
+			case test.partition == 0 && status.Partition != nil:
+				t.Errorf("partition %d, want none", *status.Partition)
+			case test.partition != 0 && (status.Partition == nil || *status.Partition != test.partition):
+				t.Errorf("partition %v, want %d", status.Partition, test.partition)
+			}
+		})
+	}
+}
@@ -17,11 +17,68 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strings"
+	"time"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
 )
 
+// sharedComponentFields are the JSON names of the fields of ComponentStatus
+// written by other reconcilers than the one of the workload
+var sharedComponentFields = map[string]bool{
+	"endpoints":       true,
+	"effectiveStatus": true,
+	"impactedBy":      true,
+	"silencedBy":      true,
+	"acknowledgement": true,
+	"availability":    true,
+	"incidents":       true,
+}
+
+// withoutSharedFields returns status with the fields written by other
+// reconcilers than the one of the workload reset
+func withoutSharedFields(status commonv1alpha1.ComponentStatus) commonv1alpha1.ComponentStatus {
+	v := reflect.ValueOf(&status).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if sharedComponentFields[name] {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+	return status
+}
+
+// optionalComponentFields are the JSON names of the optional fields of
+// ComponentStatus written by the workload reconcilers
+var optionalComponentFields = func() []string {
+	var fields []string
+	t := reflect.TypeOf(commonv1alpha1.ComponentStatus{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if len(tag) > 1 && tag[1] == "omitempty" && !sharedComponentFields[tag[0]] {
+			fields = append(fields, tag[0])
+		}
+	}
+	return fields
+}()
+
+// applicationName returns app, suffixed when it is a field of the Health
+// status which would be overwritten by the components of the application
+func applicationName(app string) string {
+	if commonv1alpha1.ReservedApplication(app) {
+		return app + "-app"
+	}
+	return app
+}
+
 func getIdentity(meta metav1.ObjectMeta) (app, component string) {
 	app, app_ok := meta.Labels["application"]
 	component, component_ok := meta.Labels["component"]
@@ -36,9 +93,126 @@ func getIdentity(meta metav1.ObjectMeta) (app, component string) {
 			component = "default"
 		}
 	}
-	return app, component
+	return applicationName(app), component
+}
+
+// resyncPeriod is how often reconcilers evaluate their objects again without
+// changes, keeping the evaluation time of components recent
+const resyncPeriod = 5 * time.Minute
+
+// scaledDown reports whether a workload is scaled to zero and all its pods
+// are gone, replicas defaults to one when unset
+func scaledDown(replicas *int32, current int32) bool {
+	return replicas != nil && *replicas == 0 && current == 0
+}
+
+// heartbeatInterval is how old the evaluation time of a component may get
+// before it is written again when its status did not change, so that
+// reconciles in between, e.g. on pod events, do not write the Health
+const heartbeatInterval = resyncPeriod / 2
+
+// sameStatus reports whether status would not change the stored one apart
+// from the evaluation time and the fields written by other reconcilers
+func sameStatus(stored, status commonv1alpha1.ComponentStatus) bool {
+	stored, status = withoutSharedFields(stored), withoutSharedFields(status)
+	stored.LastEvaluated, status.LastEvaluated = nil, nil
+	a, err := json.Marshal(stored)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(status)
+	if err != nil {
+		return false
+	}
+	return string(a) == string(b)
+}
+
+// getPatch returns a merge patch setting the status of a component of
+// health, evaluated now, nil when the stored status is the same and was
+// evaluated less than heartbeatInterval ago. Optional fields which are
+// empty in status are removed from the stored component.
+func getPatch(health *commonv1alpha1.Health, app string, component string, status commonv1alpha1.ComponentStatus) ([]byte, error) {
+	now := metav1.Now()
+	stored, ok := health.Status.Applications[app][component]
+	if ok && stored.LastEvaluated != nil && now.Sub(stored.LastEvaluated.Time) < heartbeatInterval && sameStatus(stored, status) {
+		return nil, nil
+	}
+	status.LastEvaluated = &now
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range optionalComponentFields {
+		if _, ok := fields[name]; !ok {
+			fields[name] = json.RawMessage("null")
+		}
+	}
+	return componentPatch(app, component, fields)
+}
+
+// patchHealthStatus applies a merge patch to the status of health, nothing
+// is written when patch is nil
+func patchHealthStatus(ctx context.Context, c client.StatusClient, health *commonv1alpha1.Health, patch []byte) error {
+	if patch == nil {
+		return nil
+	}
+	return c.Status().Patch(ctx, health, client.RawPatch(types.MergePatchType, patch))
+}
+
+// componentPatch returns a merge patch setting fields of a component
+func componentPatch(app string, component string, fields map[string]json.RawMessage) ([]byte, error) {
+	if commonv1alpha1.ReservedApplication(app) {
+		return nil, fmt.Errorf("%q is reserved and can not be used as an application name", app)
+	}
+	patch := map[string]map[string]map[string]map[string]json.RawMessage{
+		"status": {app: {component: fields}},
+	}
+	return json.Marshal(patch)
 }
 
-func getPatch(app string, component string, status string, generation int64) []byte {
-	return []byte(fmt.Sprintf(`{"status":{"%s": {"%s": {"status": "%s", "generation": %d}}}}`, app, component, status, generation))
+// removeComponentPatch returns a merge patch removing a component
+func removeComponentPatch(app string, component string) ([]byte, error) {
+	if commonv1alpha1.ReservedApplication(app) {
+		return nil, fmt.Errorf("%q is reserved and can not be used as an application name", app)
+	}
+	patch := map[string]map[string]map[string]interface{}{
+		"status": {app: {component: nil}},
+	}
+	return json.Marshal(patch)
+}
+
+// componentSource identifies the object the status of a component is
+// evaluated from
+func componentSource(kind, name string) string {
+	return kind + "/" + name
+}
+
+// removeComponentsOf removes the components of health evaluated from
+// source, except the ones listed in keep as "app/component". Components of
+// a deleted object or reported under another identity are removed this way.
+func removeComponentsOf(ctx context.Context, c client.StatusClient, health *commonv1alpha1.Health, source string, keep map[string]bool) error {
+	var removed [][2]string
+	for app, components := range health.Status.Applications {
+		for component, status := range components {
+			if status.Source == source && !keep[app+"/"+component] {
+				removed = append(removed, [2]string{app, component})
+			}
+		}
+	}
+	for _, key := range removed {
+		patch, err := removeComponentPatch(key[0], key[1])
+		if err != nil {
+			return err
+		}
+		err = c.Status().Patch(ctx, health, client.RawPatch(types.MergePatchType, patch))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
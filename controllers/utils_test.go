@@ -0,0 +1,256 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// mergePatch applies a JSON merge patch to a decoded document
+func mergePatch(doc, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := doc.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		target[key] = mergePatch(target[key], value)
+	}
+	return target
+}
+
+// patchHealth applies a merge patch to the JSON of health
+func patchHealth(t *testing.T, health *commonv1alpha1.Health, patch []byte) *commonv1alpha1.Health {
+	data, err := json.Marshal(health)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc, p interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := &commonv1alpha1.Health{}
+	if err := json.Unmarshal(data, patched); err != nil {
+		t.Fatalf("patched Health does not decode: %v", err)
+	}
+	return patched
+}
+
+func TestGetPatchReservedApplications(t *testing.T) {
+	for _, app := range []string{"conditions", "rollup"} {
+		t.Run(app, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			health.Status.Rollup = &commonv1alpha1.RollupStatus{Status: commonv1alpha1.StatusReady}
+			health.Status.Conditions = []commonv1alpha1.Condition{{Type: ConditionPermissionsGranted, Status: metav1.ConditionTrue}}
+
+			meta := metav1.ObjectMeta{Name: app + "-api", Labels: map[string]string{"application": app}}
+			identity, component := getIdentity(meta)
+			if identity != app+"-app" {
+				t.Errorf("application %q, want %q", identity, app+"-app")
+			}
+			patch, err := getPatch(health, identity, component, commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusDown})
+			if err != nil {
+				t.Fatal(err)
+			}
+			patched := patchHealth(t, health, patch)
+			if patched.Status.Rollup == nil || patched.Status.Rollup.Status != commonv1alpha1.StatusReady {
+				t.Errorf("rollup %+v was overwritten", patched.Status.Rollup)
+			}
+			if len(patched.Status.Conditions) != 1 {
+				t.Errorf("conditions %+v were overwritten", patched.Status.Conditions)
+			}
+			if status := patched.Status.Applications[identity][component].Status; status != commonv1alpha1.StatusDown {
+				t.Errorf("component status %q, want %q", status, commonv1alpha1.StatusDown)
+			}
+
+			if _, err := getPatch(health, app, component, commonv1alpha1.ComponentStatus{}); err == nil {
+				t.Errorf("patch of the reserved application %q", app)
+			}
+			if _, err := removeComponentPatch(app, component); err == nil {
+				t.Errorf("removal from the reserved application %q", app)
+			}
+		})
+	}
+}
+
+func TestGetIdentity(t *testing.T) {
+	tests := []struct {
+		meta      metav1.ObjectMeta
+		app       string
+		component string
+	}{
+		{meta: metav1.ObjectMeta{Name: "nova-api"}, app: "nova", component: "api"},
+		{meta: metav1.ObjectMeta{Name: "memcached"}, app: "memcached", component: "default"},
+		{
+			meta:      metav1.ObjectMeta{Name: "db", Labels: map[string]string{"application": "mariadb", "component": "server"}},
+			app:       "mariadb",
+			component: "server",
+		},
+		{meta: metav1.ObjectMeta{Name: "rollup-worker"}, app: "rollup-app", component: "worker"},
+	}
+	for _, test := range tests {
+		app, component := getIdentity(test.meta)
+		if app != test.app || component != test.component {
+			t.Errorf("%s identified as %s/%s, want %s/%s", test.meta.Name, app, component, test.app, test.component)
+		}
+	}
+}
+
+// testScheme registers the built-in types and the ones of the operator
+func testScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := commonv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestRemoveComponentsOf(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := commonv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	deployment := componentSource("Deployment", "nova-api")
+	health := &commonv1alpha1.Health{}
+	health.Name, health.Namespace = "health", "openstack"
+	health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{
+		"nova": {
+			"api":       {Status: commonv1alpha1.StatusReady, Source: deployment},
+			"os-api":    {Status: commonv1alpha1.StatusReady, Source: deployment},
+			"scheduler": {Status: commonv1alpha1.StatusReady, Source: componentSource("Deployment", "nova-scheduler")},
+		},
+		"glance": {
+			"api": {Status: commonv1alpha1.StatusReady},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, health)
+
+	err := removeComponentsOf(context.Background(), c, health, deployment, map[string]bool{"nova/os-api": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &commonv1alpha1.Health{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "health", Namespace: "openstack"}, stored); err != nil {
+		t.Fatal(err)
+	}
+	nova := stored.Status.Applications["nova"]
+	if _, ok := nova["api"]; ok {
+		t.Errorf("component reported under another identity is kept")
+	}
+	if _, ok := nova["os-api"]; !ok {
+		t.Errorf("current component is removed")
+	}
+	if _, ok := nova["scheduler"]; !ok {
+		t.Errorf("component of another source is removed")
+	}
+
+	err = removeComponentsOf(context.Background(), c, stored, deployment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "health", Namespace: "openstack"}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Status.Applications["nova"]) != 1 || len(stored.Status.Applications["glance"]) != 1 {
+		t.Errorf("applications %v, want only the scheduler and glance", stored.Status.Applications)
+	}
+}
+
+func TestGetPatchHeartbeat(t *testing.T) {
+	recent := metav1.NewTime(time.Now().Add(-time.Minute))
+	old := metav1.NewTime(time.Now().Add(-heartbeatInterval - time.Minute))
+	stored := commonv1alpha1.ComponentStatus{
+		Status:        commonv1alpha1.StatusReady,
+		Generation:    2,
+		Source:        componentSource("Deployment", "nova-api"),
+		SilencedBy:    "upgrade",
+		LastEvaluated: &recent,
+	}
+	tests := []struct {
+		name      string
+		evaluated *metav1.Time
+		status    commonv1alpha1.ComponentStatus
+		written   bool
+	}{
+		{
+			name:      "unchanged",
+			evaluated: &recent,
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Generation: 2, Source: stored.Source},
+		},
+		{
+			name:      "changed",
+			evaluated: &recent,
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusNotReady, Generation: 2, Source: stored.Source},
+			written:   true,
+		},
+		{
+			name:      "new generation",
+			evaluated: &recent,
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Generation: 3, Source: stored.Source},
+			written:   true,
+		},
+		{
+			name:      "heartbeat",
+			evaluated: &old,
+			status:    commonv1alpha1.ComponentStatus{Status: commonv1alpha1.StatusReady, Generation: 2, Source: stored.Source},
+			written:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &commonv1alpha1.Health{}
+			component := stored
+			component.LastEvaluated = test.evaluated
+			health.Status.Applications = map[string]commonv1alpha1.ApplicationStatus{"nova": {"api": component}}
+			patch, err := getPatch(health, "nova", "api", test.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (patch != nil) != test.written {
+				t.Errorf("patch %s, written %v", patch, test.written)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+// claimName is the name of the claim created from template for the pod
+// with the given ordinal of a StatefulSet
+func claimName(template string, obj *appsv1.StatefulSet, ordinal int32) string {
+	return fmt.Sprintf("%s-%s-%d", template, obj.Name, ordinal)
+}
+
+// diagnoseVolumes checks the claims created from the volumeClaimTemplates of
+// obj. Claims which do not exist yet are skipped, they are created together
+// with their pods.
+func diagnoseVolumes(ctx context.Context, c client.Client, obj *appsv1.StatefulSet) ([]commonv1alpha1.VolumeDiagnostic, error) {
+	var diagnostics []commonv1alpha1.VolumeDiagnostic
+	replicas := int32(1)
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	for _, template := range obj.Spec.VolumeClaimTemplates {
+		for ordinal := int32(0); ordinal < replicas; ordinal++ {
+			claim := &corev1.PersistentVolumeClaim{}
+			err := c.Get(ctx, types.NamespacedName{Name: claimName(template.Name, obj, ordinal), Namespace: obj.Namespace}, claim)
+			if err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			if diagnostic, ok := diagnoseVolume(claim); ok {
+				diagnostics = append(diagnostics, diagnostic)
+				if len(diagnostics) == maxDiagnostics {
+					return diagnostics, nil
+				}
+			}
+		}
+	}
+	return diagnostics, nil
+}
+
+// diagnoseVolume returns the most important problem of claim
+func diagnoseVolume(claim *corev1.PersistentVolumeClaim) (commonv1alpha1.VolumeDiagnostic, bool) {
+	diagnostic := commonv1alpha1.VolumeDiagnostic{Claim: claim.Name}
+	switch claim.Status.Phase {
+	case corev1.ClaimPending:
+		diagnostic.Reason = "Pending"
+		diagnostic.Message = "claim is not bound to a volume"
+		return diagnostic, true
+	case corev1.ClaimLost:
+		diagnostic.Reason = "Lost"
+		diagnostic.Message = fmt.Sprintf("volume %s of the claim does not exist", claim.Spec.VolumeName)
+		return diagnostic, true
+	}
+
+	for _, c := range claim.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case corev1.PersistentVolumeClaimResizing:
+			diagnostic.Reason = "Resizing"
+		case corev1.PersistentVolumeClaimFileSystemResizePending:
+			diagnostic.Reason = "FileSystemResizePending"
+		default:
+			continue
+		}
+		diagnostic.Message = c.Message
+		diagnostic.Message = truncate(diagnostic.Message, maxDiagnosticMessage)
+		return diagnostic, true
+	}
+
+	requested, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !ok {
+		return diagnostic, false
+	}
+	capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]
+	if ok && capacity.Cmp(requested) < 0 {
+		diagnostic.Reason = "CapacityMismatch"
+		diagnostic.Message = fmt.Sprintf("capacity %s is less than requested %s", capacity.String(), requested.String())
+		return diagnostic, true
+	}
+	return diagnostic, false
+}
+
+// volumeProblem returns the reason making the component of a StatefulSet
+// notready, Pending and Lost claims block pods from starting
+func volumeProblem(diagnostics []commonv1alpha1.VolumeDiagnostic) string {
+	for _, d := range diagnostics {
+		if d.Reason == "Lost" {
+			return "VolumeClaimLost"
+		}
+	}
+	for _, d := range diagnostics {
+		if d.Reason == "Pending" {
+			return "VolumeClaimPending"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
+)
+
+func volumeClaim(name string, phase corev1.PersistentVolumeClaimPhase) *corev1.PersistentVolumeClaim {
+	claim := &corev1.PersistentVolumeClaim{}
+	claim.Name, claim.Namespace = name, "openstack"
+	claim.Spec.VolumeName = "pvc-" + name
+	claim.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	claim.Status.Phase = phase
+	if phase == corev1.ClaimBound {
+		claim.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+	}
+	return claim
+}
+
+func TestDiagnoseVolume(t *testing.T) {
+	resizing := volumeClaim("resizing", corev1.ClaimBound)
+	resizing.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+		{Type: corev1.PersistentVolumeClaimResizing, Status: corev1.ConditionTrue, Message: "waiting for the volume to be expanded"},
+	}
+	resizePending := volumeClaim("resize-pending", corev1.ClaimBound)
+	resizePending.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+		{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue, Message: "waiting for the pod to restart"},
+	}
+	small := volumeClaim("small", corev1.ClaimBound)
+	small.Status.Capacity[corev1.ResourceStorage] = resource.MustParse("5Gi")
+	noRequest := volumeClaim("no-request", corev1.ClaimBound)
+	noRequest.Spec.Resources.Requests = nil
+
+	tests := []struct {
+		name       string
+		claim      *corev1.PersistentVolumeClaim
+		diagnostic *commonv1alpha1.VolumeDiagnostic
+	}{
+		{name: "bound", claim: volumeClaim("bound", corev1.ClaimBound)},
+		{
+			name:       "pending",
+			claim:      volumeClaim("pending", corev1.ClaimPending),
+			diagnostic: &commonv1alpha1.VolumeDiagnostic{Claim: "pending", Reason: "Pending", Message: "claim is not bound to a volume"},
+		},
+		{
+			name:       "lost",
+			claim:      volumeClaim("lost", corev1.ClaimLost),
+			diagnostic: &commonv1alpha1.VolumeDiagnostic{Claim: "lost", Reason: "Lost", Message: "volume pvc-lost of the claim does not exist"},
+		},
+		{
+			name:       "resizing",
+			claim:      resizing,
+			diagnostic: &commonv1alpha1.VolumeDiagnostic{Claim: "resizing", Reason: "Resizing", Message: "waiting for the volume to be expanded"},
+		},
+		{
+			name:       "file system resize pending",
+			claim:      resizePending,
+			diagnostic: &commonv1alpha1.VolumeDiagnostic{Claim: "resize-pending", Reason: "FileSystemResizePending", Message: "waiting for the pod to restart"},
+		},
+		{
+			name:       "capacity mismatch",
+			claim:      small,
+			diagnostic: &commonv1alpha1.VolumeDiagnostic{Claim: "small", Reason: "CapacityMismatch", Message: "capacity 5Gi is less than requested 10Gi"},
+		},
+		{name: "no storage request", claim: noRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostic, ok := diagnoseVolume(test.claim)
+			if ok != (test.diagnostic != nil) {
+				t.Fatalf("problem found %v, want %v: %+v", ok, test.diagnostic != nil, diagnostic)
+			}
+			if ok && diagnostic != *test.diagnostic {
+				t.Errorf("diagnostic %+v, want %+v", diagnostic, *test.diagnostic)
+			}
+		})
+	}
+}
+
+func TestDiagnoseVolumes(t *testing.T) {
+	replicas := int32(3)
+	obj := &appsv1.StatefulSet{}
+	obj.Name, obj.Namespace = "mariadb-server", "openstack"
+	obj.Spec.Replicas = &replicas
+	obj.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{}}
+	obj.Spec.VolumeClaimTemplates[0].Name = "data"
+
+	// the claim of the third pod was not created yet
+	objects := []runtime.Object{
+		volumeClaim(claimName("data", obj, 0), corev1.ClaimBound),
+		volumeClaim(claimName("data", obj, 1), corev1.ClaimPending),
+		// a claim of another StatefulSet
+		volumeClaim("data-mariadb-0", corev1.ClaimLost),
+	}
+	c := fake.NewFakeClientWithScheme(testScheme(t), objects...)
+	diagnostics, err := diagnoseVolumes(context.Background(), c, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []commonv1alpha1.VolumeDiagnostic{
+		{Claim: "data-mariadb-server-1", Reason: "Pending", Message: "claim is not bound to a volume"},
+	}
+	if !reflect.DeepEqual(diagnostics, want) {
+		t.Errorf("diagnostics %+v, want %+v", diagnostics, want)
+	}
+}
+
+func TestVolumeProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		reasons []string
+		problem string
+	}{
+		{name: "none"},
+		{name: "resizing", reasons: []string{"Resizing", "CapacityMismatch"}},
+		{name: "pending", reasons: []string{"Resizing", "Pending"}, problem: "VolumeClaimPending"},
+		{name: "lost first", reasons: []string{"Pending", "Lost"}, problem: "VolumeClaimLost"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var diagnostics []commonv1alpha1.VolumeDiagnostic
+			for _, reason := range test.reasons {
+				diagnostics = append(diagnostics, commonv1alpha1.VolumeDiagnostic{Reason: reason})
+			}
+			if problem := volumeProblem(diagnostics); problem != test.problem {
+				t.Errorf("problem %q, want %q", problem, test.problem)
+			}
+		})
+	}
+}
@@ -19,13 +19,16 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	commonv1alpha1 "github.com/amadev/health-operator/api/v1alpha1"
 	"github.com/amadev/health-operator/controllers"
@@ -47,26 +50,69 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var watchNamespaces string
+	var watchServices bool
+	var maxCheckJobs int
+	var checkServiceAccounts string
+	var prometheusURL string
+	var prometheusURLs string
+	var dependencyGating bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8081", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchNamespaces, "namespaces", os.Getenv("WATCH_NAMESPACE"),
+		"Comma separated list of namespaces to watch. All namespaces are watched when empty. "+
+			"Defaults to the WATCH_NAMESPACE environment variable.")
+	flag.BoolVar(&watchServices, "watch-services", false,
+		"Report the ready endpoints of Services in the status of their components.")
+	flag.IntVar(&maxCheckJobs, "max-check-jobs", 10,
+		"Maximum number of HealthCheck Jobs running at once. Unlimited when 0.")
+	flag.StringVar(&checkServiceAccounts, "check-service-accounts", "",
+		"Comma separated list of ServiceAccount names HealthCheck Jobs may run as. "+
+			"Jobs without one run as the default ServiceAccount without a token.")
+	flag.StringVar(&prometheusURL, "prometheus-url", "",
+		"URL of the Prometheus server queried when the spec of a Health does not set one.")
+	flag.StringVar(&prometheusURLs, "prometheus-urls", "",
+		"Comma separated list of further Prometheus server URLs the spec of a Health may set.")
+	flag.BoolVar(&dependencyGating, "dependency-gating", os.Getenv("DEPENDENCY_GATING") == "true",
+		"Serve the webhook holding the replicas of workloads until their dependencies are ready. "+
+			"Defaults to the DEPENDENCY_GATING environment variable.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "38293650.amadev.ru",
-	})
+	}
+	namespaces := splitList(watchNamespaces)
+	switch len(namespaces) {
+	case 0:
+		setupLog.Info("watching all namespaces")
+	case 1:
+		setupLog.Info("watching a single namespace", "namespace", namespaces[0])
+		options.Namespace = namespaces[0]
+	default:
+		setupLog.Info("watching multiple namespaces", "namespaces", namespaces)
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	permissions := []controllers.Permission{
+		controllers.ReadPermission("common.amadev.ru", "healths"),
+		{Group: "common.amadev.ru", Resource: "healths", Subresource: "status", Verbs: []string{"update", "patch"}},
+		{Group: "common.amadev.ru", Resource: "healths", Verbs: []string{"patch"}},
+	}
+
 	if err = (&controllers.HealthReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("Health"),
@@ -75,6 +121,10 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Health")
 		os.Exit(1)
 	}
+	permissions = append(permissions,
+		controllers.ReadPermission("apps", "deployments"),
+		controllers.ReadPermission("apps", "replicasets"),
+		controllers.ReadPermission("", "pods"))
 	if err = (&controllers.StatefulSetHealthReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("StatefulSetHealth"),
@@ -83,19 +133,172 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "StatefulSetHealth")
 		os.Exit(1)
 	}
+	permissions = append(permissions,
+		controllers.ReadPermission("apps", "statefulsets"),
+		controllers.ReadPermission("", "persistentvolumeclaims"))
+	if err = (&controllers.HealthRollupReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("HealthRollup"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("health-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HealthRollup")
+		os.Exit(1)
+	}
+	permissions = append(permissions,
+		controllers.Permission{Resource: "events", Verbs: []string{"create", "patch"}})
+	// nodes are cluster scoped and only readable with cluster wide access
 	if err = (&controllers.DaemonSetHealthReconciler{
+		Client:     mgr.GetClient(),
+		Log:        ctrl.Log.WithName("controllers").WithName("DaemonSetHealth"),
+		Scheme:     mgr.GetScheme(),
+		WatchNodes: len(namespaces) == 0,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DaemonSetHealth")
+		os.Exit(1)
+	}
+	permissions = append(permissions,
+		controllers.ReadPermission("apps", "daemonsets"),
+		controllers.ReadPermission("apps", "controllerrevisions"))
+	if len(namespaces) == 0 {
+		permissions = append(permissions, controllers.ReadPermission("", "nodes"))
+	}
+	if err = (&controllers.JobHealthReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("DaemonSetHealth"),
+		Log:    ctrl.Log.WithName("controllers").WithName("JobHealth"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "DaemonSetHealth")
+		setupLog.Error(err, "unable to create controller", "controller", "JobHealth")
+		os.Exit(1)
+	}
+	permissions = append(permissions, controllers.ReadPermission("batch", "jobs"))
+	if err = (&controllers.CronJobHealthReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CronJobHealth"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CronJobHealth")
 		os.Exit(1)
 	}
+	permissions = append(permissions, controllers.ReadPermission("batch", "cronjobs"))
+	if err = (&controllers.HealthCheckReconciler{
+		Client:               mgr.GetClient(),
+		Log:                  ctrl.Log.WithName("controllers").WithName("HealthCheck"),
+		Scheme:               mgr.GetScheme(),
+		MaxCheckJobs:         maxCheckJobs,
+		APIReader:            mgr.GetAPIReader(),
+		CheckServiceAccounts: splitList(checkServiceAccounts),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HealthCheck")
+		os.Exit(1)
+	}
+	permissions = append(permissions,
+		controllers.ReadPermission("common.amadev.ru", "healthchecks"),
+		controllers.Permission{Group: "common.amadev.ru", Resource: "healthchecks", Subresource: "status", Verbs: []string{"update", "patch"}},
+		controllers.Permission{Group: "batch", Resource: "jobs", Verbs: []string{"create", "delete"}})
+	if err = (&controllers.HealthSilenceReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("HealthSilence"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HealthSilence")
+		os.Exit(1)
+	}
+	permissions = append(permissions,
+		controllers.Permission{Group: "common.amadev.ru", Resource: "healthsilences", Verbs: []string{"get", "list", "watch", "delete"}},
+		controllers.Permission{Group: "common.amadev.ru", Resource: "healthsilences", Subresource: "status", Verbs: []string{"update", "patch"}})
+	if err = (&controllers.PrometheusHealthReconciler{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("controllers").WithName("PrometheusHealth"),
+		Scheme:      mgr.GetScheme(),
+		URL:         prometheusURL,
+		AllowedURLs: splitList(prometheusURLs),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PrometheusHealth")
+		os.Exit(1)
+	}
+	if watchServices {
+		if err = (&controllers.ServiceHealthReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("ServiceHealth"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ServiceHealth")
+			os.Exit(1)
+		}
+		permissions = append(permissions,
+			controllers.ReadPermission("", "services"),
+			controllers.ReadPermission("discovery.k8s.io", "endpointslices"))
+	}
+	// ClusterHealth aggregates all namespaces and node groups are published
+	// from nodes, both need a cluster wide cache
+	if len(namespaces) == 0 {
+		if err = (&controllers.ClusterHealthReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("ClusterHealth"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ClusterHealth")
+			os.Exit(1)
+		}
+		if err = (&controllers.NodeHealthReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("NodeHealth"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NodeHealth")
+			os.Exit(1)
+		}
+		permissions = append(permissions,
+			controllers.ReadPermission("common.amadev.ru", "clusterhealths"),
+			controllers.Permission{Group: "common.amadev.ru", Resource: "clusterhealths", Subresource: "status", Verbs: []string{"update", "patch"}},
+			controllers.ReadPermission("", "namespaces"))
+	} else {
+		setupLog.Info("ClusterHealth controller is disabled when namespaces are restricted")
+	}
+	if dependencyGating {
+		if err = (&controllers.DependencyGateReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("DependencyGate"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "DependencyGate")
+			os.Exit(1)
+		}
+		mgr.GetWebhookServer().Register("/mutate-apps-v1-workload", &webhook.Admission{Handler: &controllers.DependencyGate{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("DependencyGate"),
+		}})
+		permissions = append(permissions,
+			controllers.Permission{Group: "apps", Resource: "deployments", Verbs: []string{"patch"}},
+			controllers.Permission{Group: "apps", Resource: "statefulsets", Verbs: []string{"patch"}})
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err = mgr.Add(&controllers.PermissionChecker{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("permissions"),
+		Namespaces:  namespaces,
+		Permissions: permissions,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up permission check")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}